@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// ErrorFirma indica que no se puede firmar un comprobante del emisor: no tiene certificado
+// registrado, el certificado es de otro RUC o está fuera de su vigencia.
+type ErrorFirma struct {
+	RUC    string
+	Motivo string
+}
+
+func (e *ErrorFirma) Error() string {
+	return fmt.Sprintf("no se puede firmar como el emisor %s: %s", e.RUC, e.Motivo)
+}
+
+// AlmacenFirmas guarda el firmante de cada RUC emisor. Un emisor usa su propio certificado
+// ("firma" en su configuración) o, si no lo tiene, el común; los emisores que comparten
+// certificado comparten también el firmante.
+type AlmacenFirmas struct {
+	porRUC    map[string]*Firmante
+	firmantes []*Firmante
+}
+
+// NuevoAlmacenFirmas carga el certificado de cada emisor configurado.
+func NuevoAlmacenFirmas(cfg *Configuracion) (*AlmacenFirmas, error) {
+	type claveFirmante struct {
+		cfg    ConfigFirma
+		sufijo string
+	}
+	almacen := &AlmacenFirmas{porRUC: make(map[string]*Firmante, len(cfg.Emisores))}
+	cargados := map[claveFirmante]*Firmante{}
+	for _, em := range cfg.Emisores {
+		clave := claveFirmante{cfg: cfg.Firma}
+		if em.Firma != nil {
+			clave = claveFirmante{cfg: *em.Firma, sufijo: "_" + em.RUC}
+		}
+		f, ok := cargados[clave]
+		if !ok {
+			var err error
+			if f, err = nuevoFirmante(clave.cfg, clave.sufijo); err != nil {
+				return nil, fmt.Errorf("emisor %s: %w", em.RUC, err)
+			}
+			cargados[clave] = f
+			almacen.firmantes = append(almacen.firmantes, f)
+		}
+		almacen.porRUC[em.RUC] = f
+	}
+	return almacen, nil
+}
+
+// Emisores devuelve los RUC con certificado registrado, ordenados.
+func (a *AlmacenFirmas) Emisores() []string {
+	rucs := make([]string, 0, len(a.porRUC))
+	for ruc := range a.porRUC {
+		rucs = append(rucs, ruc)
+	}
+	slices.Sort(rucs)
+	return rucs
+}
+
+// Certificado devuelve el certificado vigente del emisor, o nil si no tiene.
+func (a *AlmacenFirmas) Certificado(ruc string) *x509.Certificate {
+	f, ok := a.porRUC[ruc]
+	if !ok {
+		return nil
+	}
+	return f.Certificado()
+}
+
+// firmaPara devuelve la versión del certificado con que se firma como ruc en el momento
+// ahora. La comprobación se hace en cada firma, y no solo al arrancar, porque el
+// certificado puede vencer o ser reemplazado por una recarga mientras el servidor corre.
+func (a *AlmacenFirmas) firmaPara(ruc string, ahora time.Time) (*firmaCargada, error) {
+	f, ok := a.porRUC[ruc]
+	if !ok {
+		return nil, &ErrorFirma{RUC: ruc, Motivo: "no tiene un certificado de firma registrado"}
+	}
+	firma := f.vigente()
+	if err := comprobarCertificado(firma.cred.cadena[0], ruc, ahora); err != nil {
+		return nil, err
+	}
+	return firma, nil
+}
+
+// comprobarCertificado verifica que cert pertenezca a ruc y esté vigente en ahora.
+func comprobarCertificado(cert *x509.Certificate, ruc string, ahora time.Time) error {
+	if !perteneceAlRUC(cert, ruc) {
+		return &ErrorFirma{RUC: ruc, Motivo: fmt.Sprintf("el certificado %q no es de ese RUC", cert.Subject.CommonName)}
+	}
+	if ahora.Before(cert.NotBefore) {
+		return &ErrorFirma{RUC: ruc, Motivo: fmt.Sprintf("el certificado %q no es válido hasta el %s", cert.Subject.CommonName, cert.NotBefore.Format("2006-01-02"))}
+	}
+	if ahora.After(cert.NotAfter) {
+		return &ErrorFirma{RUC: ruc, Motivo: fmt.Sprintf("el certificado %q venció el %s", cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))}
+	}
+	return nil
+}
+
+// Atributos del sujeto donde las entidades certificadoras ponen el RUC del titular.
+var (
+	oidSerialNumber           = asn1.ObjectIdentifier{2, 5, 4, 5}
+	oidUnidadOrganizativa     = asn1.ObjectIdentifier{2, 5, 4, 11}
+	oidOrganizationIdentifier = asn1.ObjectIdentifier{2, 5, 4, 97}
+	regexRUCEnCertificado     = regexp.MustCompile(`\b(10|15|17|20)\d{9}\b`)
+)
+
+// perteneceAlRUC indica si el certificado es del RUC. Cada entidad certificadora lo pone en
+// un lugar distinto: serialNumber, OU ("DNI 9999999 RUC 20601546913") u
+// organizationIdentifier ("VATPE-20601546913"); de esos atributos se extraen los números con
+// forma de RUC y uno debe ser exactamente ruc.
+func perteneceAlRUC(cert *x509.Certificate, ruc string) bool {
+	for _, atributo := range cert.Subject.Names {
+		if !atributo.Type.Equal(oidSerialNumber) && !atributo.Type.Equal(oidUnidadOrganizativa) && !atributo.Type.Equal(oidOrganizationIdentifier) {
+			continue
+		}
+		valor, ok := atributo.Value.(string)
+		if ok && slices.Contains(regexRUCEnCertificado.FindAllString(valor, -1), ruc) {
+			return true
+		}
+	}
+	return false
+}
+
+// vigilar recarga los certificados de todos los emisores cuando cambian sus archivos; una
+// señal por hup los recarga todos. Termina al cancelarse ctx.
+func (a *AlmacenFirmas) vigilar(ctx context.Context, hup <-chan os.Signal) {
+	senales := make([]chan os.Signal, len(a.firmantes))
+	for i, f := range a.firmantes {
+		senales[i] = make(chan os.Signal, 1)
+		go f.vigilar(ctx, senales[i])
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-hup:
+			for _, ch := range senales {
+				select {
+				case ch <- s:
+				default:
+					// Ya tiene una recarga pendiente.
+				}
+			}
+		}
+	}
+}
+
+// advertirCertificados registra al arrancar los emisores que no podrán firmar con el
+// certificado que tienen asignado, para no enterarse recién con el primer comprobante.
+func (a *AlmacenFirmas) advertirCertificados(ahora time.Time) {
+	for _, ruc := range a.Emisores() {
+		cert := a.Certificado(ruc)
+		if err := comprobarCertificado(cert, ruc, ahora); err != nil {
+			log.Printf("Atención: %v", err)
+			continue
+		}
+		log.Printf("Emisor %s firma con %q (vence %s)", ruc, cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// emitirCertificado genera un certificado autofirmado con el sujeto y la vigencia indicados.
+func emitirCertificado(t *testing.T, sujeto pkix.Name, desde, hasta time.Time) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	clave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plantilla := &x509.Certificate{SerialNumber: big.NewInt(time.Now().UnixNano()), Subject: sujeto, NotBefore: desde, NotAfter: hasta}
+	der, err := x509.CreateCertificate(rand.Reader, plantilla, plantilla, &clave.PublicKey, clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clave, cert
+}
+
+// certificadoDeRUC emite un certificado vigente con el RUC en el serialNumber del sujeto.
+func certificadoDeRUC(t *testing.T, ruc, nombre string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	return emitirCertificado(t, pkix.Name{CommonName: nombre, SerialNumber: ruc}, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+}
+
+// escribirFirmaPEM guarda el certificado y la clave en dir/nombre.pem y dir/nombre.key.
+func escribirFirmaPEM(t *testing.T, dir, nombre string, clave *rsa.PrivateKey, cert *x509.Certificate) ConfigFirma {
+	t.Helper()
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := ConfigFirma{Certificado: filepath.Join(dir, nombre+".pem"), ClavePrivada: filepath.Join(dir, nombre+".key")}
+	if err := os.WriteFile(cfg.Certificado, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.ClavePrivada, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestPerteneceAlRUC(t *testing.T) {
+	casos := []struct {
+		nombre string
+		sujeto pkix.Name
+		ruc    string
+		es     bool
+	}{
+		{"serialNumber", pkix.Name{SerialNumber: "20100066603"}, "20100066603", true},
+		{"OU con DNI y RUC", pkix.Name{OrganizationalUnit: []string{"DNI 12345678 RUC 20100066603"}}, "20100066603", true},
+		{"organizationIdentifier", pkix.Name{ExtraNames: []pkix.AttributeTypeAndValue{{Type: oidOrganizationIdentifier, Value: "VATPE-20100066603"}}}, "20100066603", true},
+		{"otro RUC", pkix.Name{SerialNumber: "20131312955"}, "20100066603", false},
+		{"RUC dentro de un número más largo", pkix.Name{SerialNumber: "201000666031"}, "20100066603", false},
+		{"RUC solo en el CN", pkix.Name{CommonName: "EMPRESA 20100066603"}, "20100066603", false},
+		{"RUC solo en la organización", pkix.Name{Organization: []string{"20100066603"}}, "20100066603", false},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			_, cert := emitirCertificado(t, c.sujeto, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+			if got := perteneceAlRUC(cert, c.ruc); got != c.es {
+				t.Errorf("perteneceAlRUC = %v, se esperaba %v", got, c.es)
+			}
+		})
+	}
+}
+
+func TestComprobarCertificado(t *testing.T) {
+	desde := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	hasta := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, cert := emitirCertificado(t, pkix.Name{CommonName: "EMPRESA", SerialNumber: "20100066603"}, desde, hasta)
+
+	casos := []struct {
+		nombre string
+		ruc    string
+		ahora  time.Time
+		motivo string // "" si el certificado sirve
+	}{
+		{"vigente", "20100066603", time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"todavía no vigente", "20100066603", time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), "no es válido hasta el 2025-01-01"},
+		{"vencido", "20100066603", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), "venció el 2026-01-01"},
+		{"otro RUC", "20131312955", time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), "no es de ese RUC"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			err := comprobarCertificado(cert, c.ruc, c.ahora)
+			if c.motivo == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var errFirma *ErrorFirma
+			if !errors.As(err, &errFirma) || errFirma.RUC != c.ruc || !strings.Contains(errFirma.Motivo, c.motivo) {
+				t.Errorf("comprobarCertificado = %v, se esperaba un ErrorFirma por %q", err, c.motivo)
+			}
+		})
+	}
+}
+
+func TestNuevoAlmacenFirmas(t *testing.T) {
+	dir := t.TempDir()
+	claveComun, certComun := certificadoDeRUC(t, "20100066603", "COMUN")
+	clavePropia, certPropio := certificadoDeRUC(t, "20131312955", "PROPIO")
+	comun := escribirFirmaPEM(t, dir, "comun", claveComun, certComun)
+	propia := escribirFirmaPEM(t, dir, "propia", clavePropia, certPropio)
+
+	cfg := &Configuracion{
+		Firma: comun,
+		Emisores: []ConfigEmisor{
+			{RUC: "20131312955", Firma: &propia},
+			{RUC: "20100066603"},
+			{RUC: "20601546913"},
+		},
+	}
+	almacen, err := NuevoAlmacenFirmas(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := almacen.Emisores(); strings.Join(got, ",") != "20100066603,20131312955,20601546913" {
+		t.Errorf("Emisores() = %v", got)
+	}
+	// Los emisores sin firma propia comparten el firmante del certificado común.
+	if len(almacen.firmantes) != 2 || almacen.porRUC["20100066603"] != almacen.porRUC["20601546913"] {
+		t.Errorf("se cargaron %d firmantes; los emisores sin firma propia deben compartir uno", len(almacen.firmantes))
+	}
+	if !almacen.Certificado("20131312955").Equal(certPropio) || !almacen.Certificado("20100066603").Equal(certComun) {
+		t.Error("Certificado() no devuelve el certificado asignado a cada emisor")
+	}
+	if almacen.Certificado("20999999999") != nil {
+		t.Error("Certificado() de un emisor sin registrar debe ser nil")
+	}
+
+	casos := []struct {
+		nombre string
+		ruc    string
+		motivo string
+	}{
+		{"certificado propio", "20131312955", ""},
+		{"certificado común", "20100066603", ""},
+		{"certificado común de otro RUC", "20601546913", "no es de ese RUC"},
+		{"emisor sin registrar", "20999999999", "no tiene un certificado de firma registrado"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			firma, err := almacen.firmaPara(c.ruc, time.Now())
+			if c.motivo == "" {
+				if err != nil || firma == nil {
+					t.Fatalf("firmaPara = %v, %v", firma, err)
+				}
+				return
+			}
+			var errFirma *ErrorFirma
+			if !errors.As(err, &errFirma) || !strings.Contains(errFirma.Motivo, c.motivo) {
+				t.Errorf("firmaPara = %v, se esperaba un ErrorFirma por %q", err, c.motivo)
+			}
+		})
+	}
+}
+
+func TestNuevoAlmacenFirmasClaveAjena(t *testing.T) {
+	dir := t.TempDir()
+	_, cert := certificadoDeRUC(t, "20100066603", "EMPRESA")
+	otraClave, _ := certificadoDeRUC(t, "20100066603", "OTRA")
+	cfg := &Configuracion{Firma: escribirFirmaPEM(t, dir, "mezcla", otraClave, cert), Emisores: []ConfigEmisor{{RUC: "20100066603"}}}
+	if _, err := NuevoAlmacenFirmas(cfg); err == nil || !strings.Contains(err.Error(), "no corresponde al certificado") {
+		t.Errorf("NuevoAlmacenFirmas con una clave que no es del certificado = %v", err)
+	}
+}
+
+func TestRecargarFirmante(t *testing.T) {
+	dir := t.TempDir()
+	claveA, certA := certificadoDeRUC(t, "20100066603", "VIEJO")
+	cfg := escribirFirmaPEM(t, dir, "firma", claveA, certA)
+	f, err := nuevoFirmante(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.cambiaron() {
+		t.Error("cambiaron() es true recién cargado")
+	}
+	anterior := f.vigente()
+
+	// Certificado renovado: la recarga lo toma y la versión anterior sigue intacta.
+	claveB, certB := certificadoDeRUC(t, "20100066603", "NUEVO")
+	escribirFirmaPEM(t, dir, "firma", claveB, certB)
+	tocar(t, cfg.Certificado, cfg.ClavePrivada)
+	if !f.cambiaron() {
+		t.Error("cambiaron() no detectó el certificado nuevo")
+	}
+	if err := f.Recargar(); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Certificado().Equal(certB) {
+		t.Errorf("después de recargar se firma con %q", f.Certificado().Subject.CommonName)
+	}
+	if !anterior.cred.cadena[0].Equal(certA) {
+		t.Error("la recarga modificó la versión que usaban las peticiones en curso")
+	}
+
+	// Archivo roto: la recarga falla, se sigue con el certificado anterior y no se vuelve a
+	// intentar hasta que el archivo cambie otra vez.
+	if err := os.WriteFile(cfg.Certificado, []byte("-----BEGIN roto"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tocar(t, cfg.Certificado)
+	if err := f.Recargar(); err == nil {
+		t.Fatal("Recargar con el certificado roto no devolvió error")
+	}
+	if !f.Certificado().Equal(certB) {
+		t.Error("una recarga fallida reemplazó el certificado vigente")
+	}
+	if f.cambiaron() {
+		t.Error("cambiaron() insiste con un archivo que ya falló")
+	}
+}
+
+func TestRecargarFirmantePFXRegistraSecretoUnaVez(t *testing.T) {
+	dir := t.TempDir()
+	clave, cert := certificadoDeRUC(t, "20100066603", "PFX")
+	const claveUnica = "clave-pfx-de-prueba-049"
+	pfx, err := pkcs12.Modern.Encode(clave, cert, nil, claveUnica)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := ConfigFirma{Certificado: filepath.Join(dir, "firma.pfx"), ClavePFX: claveUnica}
+	if err := os.WriteFile(cfg.Certificado, pfx, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := nuevoFirmante(cfg, "_PRUEBA049")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := f.Recargar(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secretosMu.RLock()
+	veces := 0
+	for _, s := range secretos {
+		if s == claveUnica {
+			veces++
+		}
+	}
+	secretosMu.RUnlock()
+	if veces != 1 {
+		t.Errorf("la clave del .pfx quedó registrada %d veces tras recargar, se esperaba 1", veces)
+	}
+	if got := redactar("clave=" + claveUnica); strings.Contains(got, claveUnica) {
+		t.Errorf("redactar no oculta la clave del .pfx: %q", got)
+	}
+}
+
+func TestVigilarFirmas(t *testing.T) {
+	dir := t.TempDir()
+	claveA, certA := certificadoDeRUC(t, "20100066603", "VIEJO")
+	cfg := escribirFirmaPEM(t, dir, "firma", claveA, certA)
+	cfg.RevisionMs = 60000 // solo recarga con la señal
+	almacen, err := NuevoAlmacenFirmas(&Configuracion{Firma: cfg, Emisores: []ConfigEmisor{{RUC: "20100066603"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hup := make(chan os.Signal, 1)
+	go almacen.vigilar(ctx, hup)
+
+	claveB, certB := certificadoDeRUC(t, "20100066603", "NUEVO")
+	escribirFirmaPEM(t, dir, "firma", claveB, certB)
+	hup <- syscall.SIGHUP
+
+	limite := time.Now().Add(5 * time.Second)
+	for !almacen.Certificado("20100066603").Equal(certB) {
+		if time.Now().After(limite) {
+			t.Fatal("SIGHUP no recargó el certificado")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// tocar adelanta la fecha de modificación de los archivos para que la revisión periódica
+// los vea cambiados aunque el sistema de archivos tenga poca resolución.
+func tocar(t *testing.T, rutas ...string) {
+	t.Helper()
+	for _, ruta := range rutas {
+		info, err := os.Stat(ruta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nueva := info.ModTime().Add(time.Second)
+		if err := os.Chtimes(ruta, nueva, nueva); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
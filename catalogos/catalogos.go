@@ -0,0 +1,212 @@
+// Package catalogos expone los catálogos de códigos de SUNAT para la facturación
+// electrónica (anexo 8 de la R.S. 097-2012/SUNAT y modificatorias) como única fuente
+// de verdad para la validación de documentos y para las listas de selección de la UI.
+//
+// Cada catálogo vive en datos/catalogoNN.tsv: la primera línea es "# NN<TAB>Nombre" y
+// las siguientes "código<TAB>descripción". Para agregar o actualizar un catálogo basta
+// con editar su archivo; se incrusta en el binario al compilar. Una cabecera
+// "# NN<TAB>Nombre<TAB>parcial" marca los catálogos de los que solo se incluyen los
+// códigos más usados: el validador rechaza igual un código que no figure en ellos, y
+// para aceptarlo hay que agregarlo al archivo. El catálogo 13 (ubigeos) se arma con el
+// archivo del INEI de datos/inei.
+package catalogos
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// Números de los catálogos que usa el conversor.
+const (
+	TipoDocumento          = "01"
+	Moneda                 = "02"
+	UnidadMedida           = "03"
+	Pais                   = "04"
+	Tributo                = "05"
+	DocumentoIdentidad     = "06"
+	AfectacionIGV          = "07"
+	SistemaISC             = "08"
+	MotivoNotaCredito      = "09"
+	MotivoNotaDebito       = "10"
+	ValorVentaResumen      = "11"
+	DocumentoRelacionado   = "12"
+	CodigoUbigeo           = "13"
+	OtroConceptoTributario = "14"
+	ElementoAdicional      = "15"
+	TipoPrecio             = "16"
+	TipoOperacionUBL20     = "17"
+	ModalidadTraslado      = "18"
+	EstadoResumen          = "19"
+	MotivoTraslado         = "20"
+	DocumentoRelacionadoGR = "21"
+	RegimenPercepcion      = "22"
+	RegimenRetencion       = "23"
+	TarifaServicioPublico  = "24"
+	ProductoSUNAT          = "25"
+	TipoPrestamo           = "26"
+	PrimeraVivienda        = "27"
+	TipoOperacion          = "51"
+	Leyenda                = "52"
+	CargoDescuento         = "53"
+	BienServicioDetraccion = "54"
+	PropiedadItem          = "55"
+	TipoServicioPublico    = "56"
+	ServicioTelecom        = "57"
+	TipoMedidor            = "58"
+	MedioPago              = "59"
+)
+
+//go:embed datos/*.tsv datos/inei/*.tsv datos/sunat/*.tsv
+var archivos embed.FS
+
+// Entrada es un código del catálogo con su descripción oficial.
+type Entrada struct {
+	Codigo      string `json:"codigo"`
+	Descripcion string `json:"descripcion"`
+}
+
+// Catalogo es una tabla de códigos de SUNAT.
+type Catalogo struct {
+	Numero string `json:"numero"`
+	Nombre string `json:"nombre"`
+	// Completo es false si el archivo solo trae parte de los códigos oficiales.
+	Completo bool      `json:"completo"`
+	Entradas []Entrada `json:"entradas"`
+	indice   map[string]int
+}
+
+var catalogos = cargar()
+
+// Obtener devuelve el catálogo con el número indicado ("03", "51", ...).
+func Obtener(numero string) (*Catalogo, bool) {
+	c, ok := catalogos[numero]
+	return c, ok
+}
+
+// Listar devuelve todos los catálogos ordenados por número.
+func Listar() []*Catalogo {
+	lista := make([]*Catalogo, 0, len(catalogos))
+	for _, c := range catalogos {
+		lista = append(lista, c)
+	}
+	sort.Slice(lista, func(i, j int) bool { return lista[i].Numero < lista[j].Numero })
+	return lista
+}
+
+// Valido indica si el código existe en el catálogo indicado.
+func Valido(numero, codigo string) bool {
+	c, ok := catalogos[numero]
+	return ok && c.Contiene(codigo)
+}
+
+// Completo indica si el catálogo incluido tiene todos los códigos oficiales, de modo que un
+// código ausente puede darse por inexistente.
+func Completo(numero string) bool {
+	c, ok := catalogos[numero]
+	return ok && c.Completo
+}
+
+// Descripcion devuelve la descripción oficial del código, o "" si no existe.
+func Descripcion(numero, codigo string) string {
+	c, ok := catalogos[numero]
+	if !ok {
+		return ""
+	}
+	e, _ := c.Buscar(codigo)
+	return e.Descripcion
+}
+
+// Buscar devuelve la entrada del código dentro del catálogo.
+func (c *Catalogo) Buscar(codigo string) (Entrada, bool) {
+	i, ok := c.indice[codigo]
+	if !ok {
+		return Entrada{}, false
+	}
+	return c.Entradas[i], true
+}
+
+// Contiene indica si el código pertenece al catálogo.
+func (c *Catalogo) Contiene(codigo string) bool {
+	_, ok := c.indice[codigo]
+	return ok
+}
+
+// cargar lee los archivos incrustados. Un archivo mal formado es un error de
+// programación, por eso se detiene el arranque en lugar de devolver un error.
+func cargar() map[string]*Catalogo {
+	rutas, err := fs.Glob(archivos, "datos/*.tsv")
+	if err != nil {
+		panic(err)
+	}
+	res := make(map[string]*Catalogo, len(rutas))
+	for _, ruta := range rutas {
+		c, err := parsear(ruta)
+		if err != nil {
+			panic(fmt.Sprintf("catálogo %s mal formado: %v", ruta, err))
+		}
+		res[c.Numero] = c
+	}
+	res[CodigoUbigeo] = catalogoUbigeos()
+	return res
+}
+
+// catalogoUbigeos expone el padrón del INEI como catálogo 13, para que la UI lo liste igual
+// que los demás.
+func catalogoUbigeos() *Catalogo {
+	c := &Catalogo{Numero: CodigoUbigeo, Nombre: "Códigos de ubigeo (INEI)", Completo: UbigeosCompletos(), indice: make(map[string]int)}
+	for _, u := range ListarUbigeos() {
+		c.indice[u.Codigo] = len(c.Entradas)
+		c.Entradas = append(c.Entradas, Entrada{Codigo: u.Codigo, Descripcion: fmt.Sprintf("%s - %s - %s", u.Departamento, u.Provincia, u.Distrito)})
+	}
+	return c
+}
+
+func parsear(ruta string) (*Catalogo, error) {
+	f, err := archivos.Open(ruta)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &Catalogo{indice: make(map[string]int)}
+	sc := bufio.NewScanner(f)
+	linea := 0
+	for sc.Scan() {
+		linea++
+		texto := strings.TrimRight(sc.Text(), "\r")
+		if texto == "" {
+			continue
+		}
+		if linea == 1 {
+			campos := strings.Split(texto, "\t")
+			if len(campos) < 2 || len(campos) > 3 || !strings.HasPrefix(campos[0], "# ") {
+				return nil, fmt.Errorf("la primera línea debe ser la cabecera \"# NN<TAB>Nombre[<TAB>parcial]\"")
+			}
+			if len(campos) == 3 && campos[2] != "parcial" {
+				return nil, fmt.Errorf("cabecera: se esperaba \"parcial\" y no %q", campos[2])
+			}
+			c.Numero, c.Nombre, c.Completo = strings.TrimPrefix(campos[0], "# "), campos[1], len(campos) == 2
+			continue
+		}
+		campos := strings.SplitN(texto, "\t", 2)
+		if len(campos) != 2 {
+			return nil, fmt.Errorf("línea %d: se esperaban dos columnas separadas por tabulador", linea)
+		}
+		if _, dup := c.indice[campos[0]]; dup {
+			return nil, fmt.Errorf("línea %d: código %q duplicado", linea, campos[0])
+		}
+		c.indice[campos[0]] = len(c.Entradas)
+		c.Entradas = append(c.Entradas, Entrada{Codigo: campos[0], Descripcion: campos[1]})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if c.Numero == "" {
+		return nil, fmt.Errorf("archivo vacío")
+	}
+	return c, nil
+}
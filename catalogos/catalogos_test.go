@@ -0,0 +1,64 @@
+package catalogos
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestValido(t *testing.T) {
+	casos := []struct {
+		catalogo, codigo string
+		valido, completo bool
+	}{
+		{Moneda, "PEN", true, true},
+		{Moneda, "ZZZ", false, true},
+		{AfectacionIGV, "10", true, true},
+		{UnidadMedida, "NIU", true, false},
+		{UnidadMedida, "XZZ", false, false},
+		{ProductoSUNAT, "43000000", true, false},
+		{ProductoSUNAT, "43211503", false, false},
+		{CodigoUbigeo, "150101", true, UbigeosCompletos()},
+		{"99", "01", false, false},
+	}
+	for _, c := range casos {
+		if got := Valido(c.catalogo, c.codigo); got != c.valido {
+			t.Errorf("Valido(%s, %s) = %t, se esperaba %t", c.catalogo, c.codigo, got, c.valido)
+		}
+		if got := Completo(c.catalogo); got != c.completo {
+			t.Errorf("Completo(%s) = %t, se esperaba %t", c.catalogo, got, c.completo)
+		}
+	}
+}
+
+func TestListar(t *testing.T) {
+	lista := Listar()
+	numeros := make([]string, len(lista))
+	for i, c := range lista {
+		numeros[i] = c.Numero
+		if c.Nombre == "" {
+			t.Errorf("el catálogo %s no tiene nombre", c.Numero)
+		}
+		for j, e := range c.Entradas {
+			if i, ok := c.indice[e.Codigo]; !ok || i != j {
+				t.Errorf("catálogo %s: el índice de %s no apunta a su entrada", c.Numero, e.Codigo)
+			}
+		}
+	}
+	if !sort.StringsAreSorted(numeros) {
+		t.Errorf("los catálogos no están ordenados: %v", numeros)
+	}
+	for _, n := range []string{"01", "13", "15", "17", "21", "24", "25", "26", "27", "56", "57", "58", "59"} {
+		if _, ok := Obtener(n); !ok {
+			t.Errorf("falta el catálogo %s", n)
+		}
+	}
+}
+
+func TestDescripcionUbigeo(t *testing.T) {
+	if got := Descripcion(CodigoUbigeo, "150101"); got != "LIMA - LIMA - LIMA" {
+		t.Errorf("Descripcion(13, 150101) = %q", got)
+	}
+	if got := Descripcion(CodigoUbigeo, "999999"); got != "" {
+		t.Errorf("Descripcion(13, 999999) = %q, se esperaba vacío", got)
+	}
+}
@@ -0,0 +1,24 @@
+package catalogos
+
+import "fmt"
+
+// Los códigos de retorno de los servicios web (excepciones de autenticación, de archivo y
+// los rechazos que llegan como SOAP fault) viven en datos/sunat/codigos_retorno.tsv con el
+// mismo formato que los catálogos. No forman parte del anexo 8, por eso Listar no los
+// incluye.
+var codigosRetorno = cargarCodigosRetorno()
+
+// MensajeRetorno devuelve el mensaje oficial del código de retorno ("0102", "1033", ...).
+func MensajeRetorno(codigo string) (string, bool) {
+	e, ok := codigosRetorno.Buscar(codigo)
+	return e.Descripcion, ok
+}
+
+func cargarCodigosRetorno() *Catalogo {
+	const ruta = "datos/sunat/codigos_retorno.tsv"
+	c, err := parsear(ruta)
+	if err != nil {
+		panic(fmt.Sprintf("catálogo %s mal formado: %v", ruta, err))
+	}
+	return c
+}
@@ -0,0 +1,101 @@
+package catalogos
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Ubigeo es un distrito del catálogo de ubicaciones geográficas del INEI.
+type Ubigeo struct {
+	Codigo       string `json:"codigo"`
+	Departamento string `json:"departamento"`
+	Provincia    string `json:"provincia"`
+	Distrito     string `json:"distrito"`
+}
+
+// El catálogo vive en datos/inei/ubigeos.tsv con las columnas
+// "ubigeo<TAB>departamento<TAB>provincia<TAB>distrito". La copia incluida trae las capitales
+// y los distritos más usados de los 25 departamentos, y lo declara con la línea "# parcial";
+// para usar el padrón completo basta con reemplazar el archivo por la exportación del INEI
+// en ese formato, sin esa línea.
+var ubigeos, ubigeosCompletos = cargarUbigeos()
+
+// BuscarUbigeo devuelve el distrito que corresponde al código INEI de 6 dígitos.
+func BuscarUbigeo(codigo string) (Ubigeo, bool) {
+	u, ok := ubigeos[codigo]
+	return u, ok
+}
+
+// UbigeosCompletos indica si el archivo tiene todos los distritos del INEI. Si no, que un
+// código no figure en él no prueba que no exista, aunque el validador lo rechaza igual.
+func UbigeosCompletos() bool {
+	return ubigeosCompletos
+}
+
+// ListarUbigeos devuelve todos los distritos ordenados por código.
+func ListarUbigeos() []Ubigeo {
+	lista := make([]Ubigeo, 0, len(ubigeos))
+	for _, u := range ubigeos {
+		lista = append(lista, u)
+	}
+	sort.Slice(lista, func(i, j int) bool { return lista[i].Codigo < lista[j].Codigo })
+	return lista
+}
+
+// MismoNombre compara nombres geográficos sin distinguir mayúsculas, tildes ni espacios extra,
+// para que "Jesús María" coincida con "JESUS MARIA".
+func MismoNombre(a, b string) bool {
+	return normalizarNombre(a) == normalizarNombre(b)
+}
+
+func normalizarNombre(s string) string {
+	// Los transformadores guardan estado, así que se arma uno nuevo por llamada.
+	quitarTildes := transform.Chain(norm.NFD, runes.Remove(runes.Predicate(func(r rune) bool {
+		return unicode.Is(unicode.Mn, r) && r != '\u0303' // se conserva la virgulilla de la Ñ
+	})), norm.NFC)
+	sinTildes, _, err := transform.String(quitarTildes, s)
+	if err != nil {
+		sinTildes = s
+	}
+	return strings.Join(strings.Fields(strings.ToUpper(sinTildes)), " ")
+}
+
+func cargarUbigeos() (map[string]Ubigeo, bool) {
+	f, err := archivos.Open("datos/inei/ubigeos.tsv")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	res := make(map[string]Ubigeo)
+	completo := true
+	sc := bufio.NewScanner(f)
+	linea := 0
+	for sc.Scan() {
+		linea++
+		texto := strings.TrimRight(sc.Text(), "\r")
+		if texto == "# parcial" {
+			completo = false
+			continue
+		}
+		if texto == "" || strings.HasPrefix(texto, "#") {
+			continue
+		}
+		campos := strings.Split(texto, "\t")
+		if len(campos) != 4 || len(campos[0]) != 6 {
+			panic(fmt.Sprintf("ubigeos.tsv mal formado en la línea %d", linea))
+		}
+		res[campos[0]] = Ubigeo{Codigo: campos[0], Departamento: campos[1], Provincia: campos[2], Distrito: campos[3]}
+	}
+	if err := sc.Err(); err != nil {
+		panic(err)
+	}
+	return res, completo
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// EstadoCDR resume el resultado que SUNAT informa en la constancia de recepción.
+type EstadoCDR string
+
+const (
+	CDRAceptado                 EstadoCDR = "ACEPTADO"
+	CDRAceptadoConObservaciones EstadoCDR = "ACEPTADO_CON_OBSERVACIONES"
+	CDRRechazado                EstadoCDR = "RECHAZADO"
+)
+
+// NotaCDR es una observación del CDR ("4252 - El dato ingresado como ...").
+type NotaCDR struct {
+	Codigo  string `json:"codigo"`
+	Mensaje string `json:"mensaje"`
+}
+
+// CDR es la constancia de recepción (ApplicationResponse) que devuelve SUNAT.
+type CDR struct {
+	Estado              EstadoCDR `json:"estado"`
+	CodigoRespuesta     string    `json:"codigoRespuesta"`
+	Descripcion         string    `json:"descripcion"`
+	Observaciones       []NotaCDR `json:"observaciones,omitempty"`
+	DocumentoReferencia string    `json:"documentoReferencia"`
+	ID                  string    `json:"id"`
+	FechaRespuesta      string    `json:"fechaRespuesta"`
+	HoraRespuesta       string    `json:"horaRespuesta"`
+	Receptor            string    `json:"receptor"`
+	// HashDocumento es el DocumentHash con que SUNAT identifica el XML recibido.
+	HashDocumento string `json:"hashDocumento,omitempty"`
+	// FirmaVerificada indica que la firma del CDR se validó contra el almacén de confianza.
+	FirmaVerificada bool `json:"firmaVerificada"`
+	// Advertencia explica por qué la firma no se verificó, si no se hizo.
+	Advertencia string `json:"advertencia,omitempty"`
+	// Archivo es el nombre del XML dentro del ZIP ("R-20601546913-01-F001-1.xml").
+	Archivo string `json:"archivo,omitempty"`
+	// XML es el CDR tal como vino dentro del ZIP, para archivarlo.
+	XML []byte `json:"-"`
+}
+
+// Aceptado indica si el comprobante quedó válido, con o sin observaciones.
+func (c *CDR) Aceptado() bool {
+	return c.Estado != CDRRechazado
+}
+
+// parsearCDR lee el ApplicationResponse. Los elementos se buscan sin prefijo porque SUNAT
+// y los OSE no usan siempre los mismos (ar:, cbc:, cac: o el espacio por defecto).
+func parsearCDR(data []byte) (*CDR, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("el CDR no es un XML válido: %w", err)
+	}
+	raiz := doc.Root()
+	if raiz == nil || raiz.Tag != "ApplicationResponse" {
+		return nil, fmt.Errorf("el CDR no es un ApplicationResponse")
+	}
+
+	respuesta := raiz.FindElement("DocumentResponse/Response")
+	if respuesta == nil {
+		return nil, fmt.Errorf("el CDR no contiene cac:DocumentResponse/cac:Response")
+	}
+
+	cdr := &CDR{
+		CodigoRespuesta:     textoDe(respuesta, "ResponseCode"),
+		Descripcion:         textoDe(respuesta, "Description"),
+		DocumentoReferencia: textoDe(raiz, "DocumentResponse/DocumentReference/ID"),
+		ID:                  textoDe(raiz, "ID"),
+		FechaRespuesta:      textoDe(raiz, "ResponseDate"),
+		HoraRespuesta:       textoDe(raiz, "ResponseTime"),
+		Receptor:            textoDe(raiz, "ReceiverParty/PartyIdentification/ID"),
+		HashDocumento:       textoDe(raiz, "DocumentResponse/DocumentReference/Attachment/ExternalReference/DocumentHash"),
+		XML:                 data,
+	}
+	if cdr.DocumentoReferencia == "" {
+		cdr.DocumentoReferencia = textoDe(respuesta, "ReferenceID")
+	}
+	for _, nota := range raiz.SelectElements("Note") {
+		cdr.Observaciones = append(cdr.Observaciones, parsearNotaCDR(nota.Text()))
+	}
+
+	codigo, err := strconv.Atoi(cdr.CodigoRespuesta)
+	if err != nil {
+		return nil, fmt.Errorf("código de respuesta del CDR inválido: %q", cdr.CodigoRespuesta)
+	}
+	cdr.Estado = clasificarCDR(codigo, len(cdr.Observaciones) > 0)
+	return cdr, nil
+}
+
+// clasificarCDR aplica los rangos de códigos de SUNAT: 0 es aceptado, 2000–3999 rechazo y
+// 4000 en adelante observaciones. Los códigos menores a 2000 son excepciones: el
+// comprobante no se procesó, así que para el emisor equivale a un rechazo.
+func clasificarCDR(codigo int, tieneNotas bool) EstadoCDR {
+	switch {
+	case codigo == 0 && tieneNotas, codigo >= 4000:
+		return CDRAceptadoConObservaciones
+	case codigo == 0:
+		return CDRAceptado
+	default:
+		return CDRRechazado
+	}
+}
+
+func parsearNotaCDR(texto string) NotaCDR {
+	texto = strings.TrimSpace(texto)
+	if codigo, mensaje, ok := strings.Cut(texto, " - "); ok {
+		return NotaCDR{Codigo: strings.TrimSpace(codigo), Mensaje: strings.TrimSpace(mensaje)}
+	}
+	return NotaCDR{Mensaje: texto}
+}
+
+func textoDe(e *etree.Element, ruta string) string {
+	if hijo := e.FindElement(ruta); hijo != nil {
+		return strings.TrimSpace(hijo.Text())
+	}
+	return ""
+}
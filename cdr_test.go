@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// cdrPrueba arma un ApplicationResponse como los de SUNAT con el código y las notas indicados.
+func cdrPrueba(codigo string, notas ...string) []byte {
+	var xmlNotas string
+	for _, n := range notas {
+		xmlNotas += "<cbc:Note>" + n + "</cbc:Note>"
+	}
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<ar:ApplicationResponse xmlns:ar="urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2"
+    xmlns:cac="urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+    xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">
+  <cbc:ID>202512345678</cbc:ID>
+  <cbc:ResponseDate>2025-01-07</cbc:ResponseDate>
+  <cbc:ResponseTime>12:00:00</cbc:ResponseTime>
+  %s
+  <cac:ReceiverParty><cac:PartyIdentification><cbc:ID>20100066603</cbc:ID></cac:PartyIdentification></cac:ReceiverParty>
+  <cac:DocumentResponse>
+    <cac:Response>
+      <cbc:ResponseCode>%s</cbc:ResponseCode>
+      <cbc:Description>La Factura numero F001-1, ha sido aceptada</cbc:Description>
+    </cac:Response>
+    <cac:DocumentReference>
+      <cbc:ID>F001-1</cbc:ID>
+      <cac:Attachment><cac:ExternalReference><cbc:DocumentHash>abc=</cbc:DocumentHash></cac:ExternalReference></cac:Attachment>
+    </cac:DocumentReference>
+  </cac:DocumentResponse>
+</ar:ApplicationResponse>`, xmlNotas, codigo))
+}
+
+func TestParsearCDR(t *testing.T) {
+	casos := []struct {
+		nombre        string
+		xml           []byte
+		estado        EstadoCDR
+		observaciones []NotaCDR
+	}{
+		{nombre: "aceptado", xml: cdrPrueba("0"), estado: CDRAceptado},
+		{nombre: "aceptado con notas", xml: cdrPrueba("0", "4252 - El dato ingresado como dirección no cumple con el formato"),
+			estado: CDRAceptadoConObservaciones, observaciones: []NotaCDR{{Codigo: "4252", Mensaje: "El dato ingresado como dirección no cumple con el formato"}}},
+		{nombre: "observado por código", xml: cdrPrueba("4287"), estado: CDRAceptadoConObservaciones},
+		{nombre: "rechazado", xml: cdrPrueba("2800"), estado: CDRRechazado},
+		{nombre: "excepción", xml: cdrPrueba("0156"), estado: CDRRechazado},
+		{nombre: "nota sin código", xml: cdrPrueba("0", "Observación libre"),
+			estado: CDRAceptadoConObservaciones, observaciones: []NotaCDR{{Mensaje: "Observación libre"}}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			cdr, err := parsearCDR(c.xml)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cdr.Estado != c.estado {
+				t.Errorf("estado %s, se esperaba %s", cdr.Estado, c.estado)
+			}
+			if cdr.DocumentoReferencia != "F001-1" || cdr.Receptor != "20100066603" || cdr.HashDocumento != "abc=" || cdr.ID != "202512345678" {
+				t.Errorf("datos del CDR mal leídos: %+v", cdr)
+			}
+			if len(cdr.Observaciones) != len(c.observaciones) {
+				t.Fatalf("observaciones %+v, se esperaba %+v", cdr.Observaciones, c.observaciones)
+			}
+			for i, o := range c.observaciones {
+				if cdr.Observaciones[i] != o {
+					t.Errorf("observación %d = %+v, se esperaba %+v", i, cdr.Observaciones[i], o)
+				}
+			}
+		})
+	}
+}
+
+func TestParsearCDRInvalido(t *testing.T) {
+	casos := map[string][]byte{
+		"no es XML":          []byte("PK\x03\x04"),
+		"otro documento":     []byte(`<Invoice><ID>F001-1</ID></Invoice>`),
+		"sin Response":       []byte(`<ApplicationResponse><ID>1</ID></ApplicationResponse>`),
+		"código no numérico": cdrPrueba("OK"),
+	}
+	for nombre, xml := range casos {
+		if _, err := parsearCDR(xml); err == nil {
+			t.Errorf("%s: se esperaba un error", nombre)
+		}
+	}
+}
+
+func TestClasificarCDR(t *testing.T) {
+	casos := []struct {
+		codigo int
+		notas  bool
+		estado EstadoCDR
+	}{
+		{0, false, CDRAceptado},
+		{0, true, CDRAceptadoConObservaciones},
+		{98, false, CDRRechazado},
+		{1999, false, CDRRechazado},
+		{2000, false, CDRRechazado},
+		{3999, true, CDRRechazado},
+		{4000, false, CDRAceptadoConObservaciones},
+		{4999, false, CDRAceptadoConObservaciones},
+	}
+	for _, c := range casos {
+		if e := clasificarCDR(c.codigo, c.notas); e != c.estado {
+			t.Errorf("clasificarCDR(%d, %t) = %s, se esperaba %s", c.codigo, c.notas, e, c.estado)
+		}
+	}
+}
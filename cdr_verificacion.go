@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// ErrorCDR indica que el CDR recibido no puede tomarse como constancia del comprobante
+// enviado: la firma no es de un certificado de confianza o el CDR es de otro documento.
+type ErrorCDR struct {
+	Documento string
+	Motivo    string
+}
+
+func (e *ErrorCDR) Error() string {
+	return fmt.Sprintf("el CDR recibido para %s no es válido: %s", e.Documento, e.Motivo)
+}
+
+// cargarCertificados lee los certificados PEM (uno o varios por archivo) del almacén de
+// confianza con que se verifican los CDR.
+func cargarCertificados(rutas []string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, ruta := range rutas {
+		data, err := os.ReadFile(ruta)
+		if err != nil {
+			return nil, fmt.Errorf("no se pudo leer el certificado %s: %w", ruta, err)
+		}
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("certificado inválido en %s: %w", ruta, err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if len(rutas) > 0 && len(certs) == 0 {
+		return nil, fmt.Errorf("los archivos %v no contienen certificados PEM", rutas)
+	}
+	return certs, nil
+}
+
+// verificarCDR comprueba que el CDR sea la constancia del documento enviado:
+//   - si el entorno tiene almacén de confianza, la firma XMLDSig debe ser válida y de uno
+//     de sus certificados; si no lo tiene, el CDR queda con FirmaVerificada en false y una
+//     Advertencia que lo dice;
+//   - el DocumentReference debe ser la serie-correlativo enviada;
+//   - si el CDR trae DocumentHash, debe ser el SHA-256 del XML firmado que enviamos o el
+//     DigestValue de su firma (según el servicio, SUNAT informa uno u otro).
+//
+// xmlEnviado puede ser nil cuando el CDR se recupera sin tener el XML a mano.
+func (c *Client) verificarCDR(cdr *CDR, documento string, xmlEnviado []byte) error {
+	if len(c.confianzaCDR) > 0 {
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(cdr.XML); err != nil {
+			return &ErrorCDR{Documento: documento, Motivo: "no es un XML válido"}
+		}
+		ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: c.confianzaCDR})
+		if _, err := ctx.Validate(doc.Root()); err != nil {
+			return &ErrorCDR{Documento: documento, Motivo: fmt.Sprintf("la firma no es válida o no es de un certificado de confianza: %v", err)}
+		}
+		cdr.FirmaVerificada = true
+	} else {
+		cdr.Advertencia = fmt.Sprintf("la firma del CDR no se verificó: el entorno %s no tiene certificadosCdr", c.Entorno.Nombre)
+	}
+
+	if cdr.DocumentoReferencia != documento {
+		return &ErrorCDR{Documento: documento, Motivo: fmt.Sprintf("corresponde al documento %q", cdr.DocumentoReferencia)}
+	}
+	if cdr.HashDocumento != "" && xmlEnviado != nil {
+		hash := sha256.Sum256(xmlEnviado)
+		if cdr.HashDocumento != base64.StdEncoding.EncodeToString(hash[:]) && cdr.HashDocumento != digestFirma(xmlEnviado) {
+			return &ErrorCDR{Documento: documento, Motivo: "el hash del documento no coincide con el XML enviado"}
+		}
+	}
+	return nil
+}
+
+// digestFirma devuelve el DigestValue de la firma del XML enviado, o "" si no lo tiene.
+func digestFirma(xmlFirmado []byte) string {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlFirmado); err != nil {
+		return ""
+	}
+	return textoDe(doc.Root(), "//Signature/SignedInfo/Reference/DigestValue")
+}
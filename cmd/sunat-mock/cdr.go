@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// rucSUNAT es el RUC con que SUNAT firma sus constancias.
+const rucSUNAT = "20131312955"
+
+// firmante firma los CDR simulados con el certificado indicado al arrancar.
+type firmante struct {
+	clave *rsa.PrivateKey
+	cert  *x509.Certificate
+}
+
+func cargarFirmante(rutaClave, rutaCert string) (*firmante, error) {
+	keyData, err := os.ReadFile(rutaClave)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, fmt.Errorf("%s no contiene un bloque PEM", rutaClave)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s no es una clave RSA", rutaClave)
+	}
+
+	certData, err := os.ReadFile(rutaCert)
+	if err != nil {
+		return nil, err
+	}
+	block, _ = pem.Decode(certData)
+	if block == nil {
+		return nil, fmt.Errorf("%s no contiene un bloque PEM", rutaCert)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &firmante{clave: rsaKey, cert: cert}, nil
+}
+
+// datosCDR es lo que el simulador pone en la constancia de un comprobante recibido.
+type datosCDR struct {
+	ruc, tipo, serie, numero string
+	// id reemplaza a serie-numero en los resúmenes ("RC-20261018-1").
+	id                  string
+	xml                 []byte
+	codigo, descripcion string
+	notas               []string
+}
+
+func (d datosCDR) documento() string {
+	if d.id != "" {
+		return d.id
+	}
+	return d.serie + "-" + d.numero
+}
+
+// construirCDR arma el ApplicationResponse firmado y el nombre con que SUNAT lo pone en el
+// ZIP de respuesta (R-RUC-TT-SERIE-NUMERO.xml).
+func (f *firmante) construirCDR(d datosCDR) (nombre string, xmlCDR []byte, err error) {
+	ahora := time.Now().In(time.FixedZone("PET", -5*60*60))
+	hash := sha256.Sum256(d.xml)
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	raiz := doc.CreateElement("ar:ApplicationResponse")
+	raiz.CreateAttr("xmlns", "urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2")
+	raiz.CreateAttr("xmlns:ar", "urn:oasis:names:specification:ubl:schema:xsd:ApplicationResponse-2")
+	raiz.CreateAttr("xmlns:cac", "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2")
+	raiz.CreateAttr("xmlns:cbc", "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2")
+	raiz.CreateAttr("xmlns:ext", "urn:oasis:names:specification:ubl:schema:xsd:CommonExtensionComponents-2")
+	raiz.CreateAttr("xmlns:ds", "http://www.w3.org/2000/09/xmldsig#")
+
+	raiz.CreateElement("ext:UBLExtensions").CreateElement("ext:UBLExtension").CreateElement("ext:ExtensionContent")
+	raiz.CreateElement("cbc:UBLVersionID").SetText("2.0")
+	raiz.CreateElement("cbc:CustomizationID").SetText("1.0")
+	raiz.CreateElement("cbc:ID").SetText(fmt.Sprintf("%d", ahora.UnixMilli()))
+	raiz.CreateElement("cbc:IssueDate").SetText(ahora.Format("2006-01-02"))
+	raiz.CreateElement("cbc:IssueTime").SetText(ahora.Format("15:04:05"))
+	raiz.CreateElement("cbc:ResponseDate").SetText(ahora.Format("2006-01-02"))
+	raiz.CreateElement("cbc:ResponseTime").SetText(ahora.Format("15:04:05"))
+	for _, n := range d.notas {
+		raiz.CreateElement("cbc:Note").SetText(n)
+	}
+	raiz.CreateElement("cac:SenderParty").CreateElement("cac:PartyIdentification").CreateElement("cbc:ID").SetText(rucSUNAT)
+	raiz.CreateElement("cac:ReceiverParty").CreateElement("cac:PartyIdentification").CreateElement("cbc:ID").SetText("6-" + d.ruc)
+
+	respuesta := raiz.CreateElement("cac:DocumentResponse")
+	r := respuesta.CreateElement("cac:Response")
+	r.CreateElement("cbc:ReferenceID").SetText(d.documento())
+	r.CreateElement("cbc:ResponseCode").SetText(d.codigo)
+	r.CreateElement("cbc:Description").SetText(d.descripcion)
+	ref := respuesta.CreateElement("cac:DocumentReference")
+	ref.CreateElement("cbc:ID").SetText(d.documento())
+	ref.CreateElement("cbc:DocumentTypeCode").SetText(d.tipo)
+	ref.CreateElement("cac:Attachment").CreateElement("cac:ExternalReference").CreateElement("cbc:DocumentHash").SetText(base64.StdEncoding.EncodeToString(hash[:]))
+
+	ctx, err := dsig.NewSigningContext(f.clave, [][]byte{f.cert.Raw})
+	if err != nil {
+		return "", nil, err
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10RecCanonicalizer()
+	ctx.Hash = crypto.SHA256
+	firmado, err := ctx.SignEnveloped(raiz)
+	if err != nil {
+		return "", nil, fmt.Errorf("error al firmar el CDR: %w", err)
+	}
+	// La firma queda al final de la raíz; SUNAT la pone dentro de ext:ExtensionContent.
+	// SignEnveloped la agrega sin enlazarla a la raíz, así que RemoveChild no la
+	// encuentra: se quita por posición.
+	contenido := firmado.FindElement("./ext:UBLExtensions/ext:UBLExtension/ext:ExtensionContent")
+	if ultimo := len(firmado.Child) - 1; contenido != nil && ultimo >= 0 {
+		firma := firmado.Child[ultimo]
+		firmado.Child = firmado.Child[:ultimo]
+		contenido.AddChild(firma)
+	}
+	doc.SetRoot(firmado)
+
+	xmlCDR, err = doc.WriteToBytes()
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("R-%s-%s-%s-%s.xml", d.ruc, d.tipo, d.serie, d.numero), xmlCDR, nil
+}
+
+// archivo es un XML dentro de un ZIP.
+type archivo struct {
+	nombre string
+	datos  []byte
+}
+
+func crearZip(archivos []archivo) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, a := range archivos {
+		f, err := w.Create(a.nombre)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(a.datos); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
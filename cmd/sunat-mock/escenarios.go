@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Tipos de respuesta que puede simular el servidor.
+const (
+	escenarioAceptado  = "aceptado"  // CDR con ResponseCode 0
+	escenarioObservado = "observado" // CDR con ResponseCode 0 y una nota "codigo - mensaje"
+	escenarioRechazado = "rechazado" // CDR con ResponseCode = codigo (2000–3999)
+	escenarioFault     = "fault"     // SOAP fault con el código indicado
+	escenarioLento     = "lento"     // espera demoraMs y luego acepta
+	escenarioError500  = "error500"  // HTTP 500 sin SOAP fault
+)
+
+// Escenario define qué responde el simulador para un comprobante.
+type Escenario struct {
+	Tipo     string `json:"tipo"`
+	Codigo   string `json:"codigo,omitempty"`
+	Mensaje  string `json:"mensaje,omitempty"`
+	DemoraMs int    `json:"demoraMs,omitempty"`
+}
+
+func (e Escenario) validar() error {
+	switch e.Tipo {
+	case escenarioAceptado, escenarioLento, escenarioError500:
+		return nil
+	case escenarioObservado, escenarioRechazado, escenarioFault:
+		if e.Codigo == "" {
+			return fmt.Errorf("el escenario %q necesita un código", e.Tipo)
+		}
+		return nil
+	}
+	return fmt.Errorf("escenario desconocido %q", e.Tipo)
+}
+
+// escenarios asocia comprobantes ("F001-3") a un escenario; "*" es el que se usa si el
+// comprobante no tiene uno propio.
+type escenarios struct {
+	mu      sync.RWMutex
+	porDoc  map[string]Escenario
+	defecto Escenario
+	inicial Escenario
+}
+
+func nuevosEscenarios(defecto Escenario) *escenarios {
+	return &escenarios{porDoc: map[string]Escenario{}, defecto: defecto, inicial: defecto}
+}
+
+// cargar lee un archivo JSON {"*": {...}, "F001-3": {...}}.
+func (e *escenarios) cargar(ruta string) error {
+	data, err := os.ReadFile(ruta)
+	if err != nil {
+		return err
+	}
+	var m map[string]Escenario
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%s no es un JSON válido: %w", ruta, err)
+	}
+	for doc, esc := range m {
+		if err := e.definir(doc, esc); err != nil {
+			return fmt.Errorf("%s: %w", doc, err)
+		}
+	}
+	return nil
+}
+
+func (e *escenarios) definir(doc string, esc Escenario) error {
+	if err := esc.validar(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if doc == "*" {
+		e.defecto = esc
+	} else {
+		e.porDoc[doc] = esc
+	}
+	return nil
+}
+
+// reiniciar borra los escenarios por comprobante y vuelve al de la línea de comandos.
+func (e *escenarios) reiniciar() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.porDoc = map[string]Escenario{}
+	e.defecto = e.inicial
+}
+
+func (e *escenarios) para(doc string) Escenario {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if esc, ok := e.porDoc[doc]; ok {
+		return esc
+	}
+	return e.defecto
+}
+
+func (e *escenarios) listar() map[string]Escenario {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	m := make(map[string]Escenario, len(e.porDoc)+1)
+	for k, v := range e.porDoc {
+		m[k] = v
+	}
+	m["*"] = e.defecto
+	return m
+}
@@ -0,0 +1,501 @@
+// Command sunat-mock simula los servicios web de SUNAT para desarrollo y pruebas, sin
+// depender de e-beta: sendBill, sendSummary, sendPack y getStatus de billService, y
+// getStatus y getStatusCdr de billConsultService. Revisa las credenciales WS-Security,
+// abre los ZIP recibidos y responde con CDR firmados.
+//
+// Uso:
+//
+//	go run ./cmd/sunat-mock -addr :9090 -escenario rechazado -codigo 2017
+//
+// y en la configuración del conversor un entorno que apunte al simulador:
+//
+//	"entornos": {"mock": {"urlFacturas": "http://localhost:9090/billService",
+//	                      "urlConsulta": "http://localhost:9090/billConsultService",
+//	                      "usuarioConRuc": true, "usuarioPrueba": "MODDATOS", "clavePrueba": "MODDATOS"}}
+//
+// La respuesta por comprobante se cambia en caliente con PUT /_mock/escenarios/{serie-numero}
+// (o "*" para todos), p. ej. {"tipo": "fault", "codigo": "0109"}; DELETE /_mock borra los
+// escenarios y los comprobantes recibidos.
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+var (
+	regexComprobante = regexp.MustCompile(`^(\d{11})-(\d{2})-([A-Z0-9]{4})-(\d{1,8})$`)
+	regexResumen     = regexp.MustCompile(`^(\d{11})-(RC|RA|RR)-(\d{8})-(\d{1,5})$`)
+	regexLote        = regexp.MustCompile(`^(\d{11})-LT-(\d{8})-(\d{1,5})$`)
+
+	nombresTipo = map[string]string{"01": "Factura", "03": "Boleta de Venta", "07": "Nota de Credito", "08": "Nota de Debito"}
+)
+
+// faultSUNAT es una excepción que el simulador devuelve como SOAP fault.
+type faultSUNAT struct {
+	codigo, mensaje string
+}
+
+func (f *faultSUNAT) Error() string { return f.codigo + " - " + f.mensaje }
+
+// registro es un comprobante recibido, con su CDR.
+type registro struct {
+	cdr      archivo
+	aceptado bool
+}
+
+type simulador struct {
+	usuario, clave string
+	escenarios     *escenarios
+	firmante       *firmante
+
+	mu           sync.Mutex
+	registros    map[string]registro // RUC-TT-SERIE-NUMERO
+	tickets      map[string][]archivo
+	ultimoTicket int64
+}
+
+func main() {
+	addr := flag.String("addr", ":9090", "dirección en la que escucha el simulador")
+	usuario := flag.String("usuario", "", "usuario SOL esperado, sin el RUC (vacío acepta cualquiera)")
+	clave := flag.String("clave", "", "clave SOL esperada (vacío acepta cualquiera)")
+	tipo := flag.String("escenario", escenarioAceptado, "respuesta por defecto: aceptado, observado, rechazado, fault, lento o error500")
+	codigo := flag.String("codigo", "", "código de SUNAT para los escenarios observado, rechazado y fault")
+	mensaje := flag.String("mensaje", "", "mensaje que acompaña al código")
+	demora := flag.Int("demora", 0, "milisegundos que tarda el escenario lento")
+	archivoEscenarios := flag.String("escenarios", "", "archivo JSON con escenarios por comprobante")
+	cert := flag.String("cert", "./certs/public.pem", "certificado con que se firman los CDR")
+	key := flag.String("key", "./certs/private_pkcs8.key", "clave privada PKCS#8 con que se firman los CDR")
+	flag.Parse()
+
+	defecto := Escenario{Tipo: *tipo, Codigo: *codigo, Mensaje: *mensaje, DemoraMs: *demora}
+	if err := defecto.validar(); err != nil {
+		log.Fatalf("Escenario inválido: %v", err)
+	}
+	esc := nuevosEscenarios(defecto)
+	if *archivoEscenarios != "" {
+		if err := esc.cargar(*archivoEscenarios); err != nil {
+			log.Fatalf("No se pudieron cargar los escenarios: %v", err)
+		}
+	}
+	f, err := cargarFirmante(*key, *cert)
+	if err != nil {
+		log.Fatalf("No se pudo cargar el certificado de firma: %v", err)
+	}
+
+	s := &simulador{
+		usuario:    *usuario,
+		clave:      *clave,
+		escenarios: esc,
+		firmante:   f,
+		registros:  map[string]registro{},
+		tickets:    map[string][]archivo{},
+	}
+
+	http.HandleFunc("GET /_mock/escenarios", s.listarEscenarios)
+	http.HandleFunc("PUT /_mock/escenarios/{documento}", s.definirEscenario)
+	http.HandleFunc("DELETE /_mock", s.reiniciar)
+	http.Handle("/", s)
+
+	log.Printf("Simulador de SUNAT escuchando en %s (escenario por defecto: %s)", *addr, defecto.Tipo)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		log.Fatalf("Error al iniciar el servidor: %v", err)
+	}
+}
+
+// ServeHTTP atiende cualquier ruta como billService o billConsultService.
+func (s *simulador) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	doc := etree.NewDocument()
+	if _, err := doc.ReadFrom(r.Body); err != nil {
+		responderFault(w, &faultSUNAT{"0305", "El sistema no puede procesar el archivo xml"})
+		return
+	}
+	op := doc.FindElement("//Body/*")
+	if op == nil {
+		responderFault(w, &faultSUNAT{"0301", "Elemento raíz del xml no está definido"})
+		return
+	}
+
+	usuario := texto(doc.Root(), "//UsernameToken/Username")
+	if f := s.autenticar(usuario, texto(doc.Root(), "//UsernameToken/Password")); f != nil {
+		log.Printf("%s rechazado: %v", op.Tag, f)
+		responderFault(w, f)
+		return
+	}
+
+	var (
+		cuerpo string
+		err    error
+	)
+	switch op.Tag {
+	case "sendBill":
+		cuerpo, err = s.sendBill(w, usuario, texto(op, "fileName"), texto(op, "contentFile"))
+	case "sendSummary":
+		cuerpo, err = s.sendTicket(usuario, regexResumen, texto(op, "fileName"), texto(op, "contentFile"))
+	case "sendPack":
+		cuerpo, err = s.sendTicket(usuario, regexLote, texto(op, "fileName"), texto(op, "contentFile"))
+	case "getStatus":
+		if ticket := texto(op, "ticket"); ticket != "" {
+			cuerpo, err = s.getStatusTicket(ticket)
+		} else {
+			cuerpo = s.getStatusComprobante(op, false)
+		}
+	case "getStatusCdr":
+		cuerpo = s.getStatusComprobante(op, true)
+	default:
+		err = &faultSUNAT{"0100", "Operación no soportada por el simulador: " + op.Tag}
+	}
+
+	var f *faultSUNAT
+	switch {
+	case errors.As(err, &f):
+		log.Printf("%s: fault %v", op.Tag, f)
+		responderFault(w, f)
+	case errors.Is(err, errRespondido):
+	case err != nil:
+		log.Printf("%s: %v", op.Tag, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		responderSOAP(w, fmt.Sprintf(`<br:%sResponse xmlns:br="http://service.sunat.gob.pe">%s</br:%sResponse>`, op.Tag, cuerpo, op.Tag))
+	}
+}
+
+// errRespondido indica que el escenario ya escribió la respuesta (error500).
+var errRespondido = errors.New("respuesta ya enviada")
+
+func (s *simulador) autenticar(usuario, clave string) *faultSUNAT {
+	if usuario == "" {
+		return &faultSUNAT{"0101", "El encabezado de seguridad es incorrecto"}
+	}
+	if s.usuario != "" && !strings.HasSuffix(usuario, s.usuario) {
+		return &faultSUNAT{"0103", "El Usuario ingresado no existe"}
+	}
+	if s.clave != "" && clave != s.clave {
+		return &faultSUNAT{"0104", "La Clave ingresada es incorrecta"}
+	}
+	return nil
+}
+
+func (s *simulador) sendBill(w http.ResponseWriter, usuario, nombreZip, contenido string) (string, error) {
+	base := strings.TrimSuffix(nombreZip, ".zip")
+	m := regexComprobante.FindStringSubmatch(base)
+	if m == nil || !strings.HasSuffix(nombreZip, ".zip") {
+		return "", &faultSUNAT{"0151", "El nombre del archivo ZIP es incorrecto"}
+	}
+	if f := rucDelUsuario(usuario, m[1]); f != nil {
+		return "", f
+	}
+	archivos, err := abrirZip(contenido)
+	if err != nil {
+		return "", err
+	}
+	if len(archivos) != 1 {
+		return "", &faultSUNAT{"0158", "El archivo ZIP contiene demasiados comprobantes para este tipo de envío"}
+	}
+	if archivos[0].nombre != base+".xml" {
+		return "", &faultSUNAT{"0161", "El nombre del archivo XML no coincide con el nombre del archivo ZIP"}
+	}
+
+	esc := s.escenarios.para(m[3] + "-" + m[4])
+	switch esc.Tipo {
+	case escenarioError500:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return "", errRespondido
+	case escenarioFault:
+		return "", &faultSUNAT{esc.Codigo, primero(esc.Mensaje, "Error simulado")}
+	case escenarioLento:
+		time.Sleep(time.Duration(esc.DemoraMs) * time.Millisecond)
+	}
+
+	cdr, err := s.recibir(m[1], m[2], m[3], m[4], archivos[0].datos, esc)
+	if err != nil {
+		return "", err
+	}
+	zipCDR, err := crearZip([]archivo{cdr})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<applicationResponse>%s</applicationResponse>", base64.StdEncoding.EncodeToString(zipCDR)), nil
+}
+
+// sendTicket atiende sendSummary y sendPack: recibe el ZIP, genera los CDR y devuelve un
+// ticket que se resuelve con getStatus.
+func (s *simulador) sendTicket(usuario string, patron *regexp.Regexp, nombreZip, contenido string) (string, error) {
+	base := strings.TrimSuffix(nombreZip, ".zip")
+	m := patron.FindStringSubmatch(base)
+	if m == nil || !strings.HasSuffix(nombreZip, ".zip") {
+		return "", &faultSUNAT{"0151", "El nombre del archivo ZIP es incorrecto"}
+	}
+	if f := rucDelUsuario(usuario, m[1]); f != nil {
+		return "", f
+	}
+	archivos, err := abrirZip(contenido)
+	if err != nil {
+		return "", err
+	}
+
+	var cdrs []archivo
+	if patron == regexResumen {
+		if len(archivos) != 1 || archivos[0].nombre != base+".xml" {
+			return "", &faultSUNAT{"0161", "El nombre del archivo XML no coincide con el nombre del archivo ZIP"}
+		}
+		cdr, err := s.recibirResumen(m[1], m[2], m[3], m[4], archivos[0].datos)
+		if err != nil {
+			return "", err
+		}
+		cdrs = append(cdrs, cdr)
+	} else {
+		for _, a := range archivos {
+			mc := regexComprobante.FindStringSubmatch(strings.TrimSuffix(a.nombre, ".xml"))
+			if mc == nil || mc[1] != m[1] {
+				return "", &faultSUNAT{"0159", "El nombre del archivo XML es incorrecto"}
+			}
+			esc := s.escenarios.para(mc[3] + "-" + mc[4])
+			if esc.Tipo == escenarioFault {
+				// Dentro de un lote la excepción de un comprobante llega como rechazo en su CDR.
+				esc.Tipo = escenarioRechazado
+			}
+			cdr, err := s.recibir(mc[1], mc[2], mc[3], mc[4], a.datos, esc)
+			var f *faultSUNAT
+			if errors.As(err, &f) {
+				// Igual que con el escenario fault: el lote sigue y el comprobante se rechaza.
+				d := datosComprobante(mc[1], mc[2], mc[3], mc[4], a.datos, Escenario{Tipo: escenarioRechazado, Codigo: f.codigo, Mensaje: f.mensaje})
+				cdr.nombre, cdr.datos, err = s.firmante.construirCDR(d)
+			}
+			if err != nil {
+				return "", err
+			}
+			cdrs = append(cdrs, cdr)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ultimoTicket = max(s.ultimoTicket+1, time.Now().UnixMilli())
+	ticket := fmt.Sprintf("%d", s.ultimoTicket)
+	s.tickets[ticket] = cdrs
+	log.Printf("%s recibido con ticket %s (%d CDR)", nombreZip, ticket, len(cdrs))
+	return fmt.Sprintf("<ticket>%s</ticket>", ticket), nil
+}
+
+// recibir registra el comprobante y arma su CDR según el escenario.
+func (s *simulador) recibir(ruc, tipo, serie, numero string, xml []byte, esc Escenario) (archivo, error) {
+	if err := etree.NewDocument().ReadFromBytes(xml); err != nil {
+		return archivo{}, &faultSUNAT{"0306", "No se puede leer (parsear) el archivo XML"}
+	}
+	clave := fmt.Sprintf("%s-%s-%s-%s", ruc, tipo, serie, numero)
+
+	s.mu.Lock()
+	_, existe := s.registros[clave]
+	s.mu.Unlock()
+	if existe {
+		return archivo{}, &faultSUNAT{"1033", "El comprobante fue registrado previamente con otros datos"}
+	}
+
+	d := datosComprobante(ruc, tipo, serie, numero, xml, esc)
+	nombre, xmlCDR, err := s.firmante.construirCDR(d)
+	if err != nil {
+		return archivo{}, err
+	}
+	cdr := archivo{nombre: nombre, datos: xmlCDR}
+	s.mu.Lock()
+	s.registros[clave] = registro{cdr: cdr, aceptado: d.codigo == "0"}
+	s.mu.Unlock()
+	log.Printf("%s recibido: %s (%s)", clave, esc.Tipo, d.codigo)
+	return cdr, nil
+}
+
+// datosComprobante arma el contenido del CDR de un comprobante según el escenario.
+func datosComprobante(ruc, tipo, serie, numero string, xml []byte, esc Escenario) datosCDR {
+	d := datosCDR{ruc: ruc, tipo: tipo, serie: serie, numero: numero, xml: xml, codigo: "0"}
+	nombreTipo := primero(nombresTipo[tipo], "Comprobante")
+	d.descripcion = fmt.Sprintf("La %s numero %s-%s, ha sido aceptada", nombreTipo, serie, numero)
+	switch esc.Tipo {
+	case escenarioObservado:
+		d.notas = []string{esc.Codigo + " - " + primero(esc.Mensaje, "Observación simulada")}
+	case escenarioRechazado:
+		d.codigo = esc.Codigo
+		d.descripcion = fmt.Sprintf("La %s numero %s-%s, ha sido rechazada: %s", nombreTipo, serie, numero, primero(esc.Mensaje, "Rechazo simulado"))
+	}
+	return d
+}
+
+func (s *simulador) recibirResumen(ruc, tipo, fecha, numero string, xml []byte) (archivo, error) {
+	if err := etree.NewDocument().ReadFromBytes(xml); err != nil {
+		return archivo{}, &faultSUNAT{"0306", "No se puede leer (parsear) el archivo XML"}
+	}
+	id := fmt.Sprintf("%s-%s-%s", tipo, fecha, numero)
+	d := datosCDR{ruc: ruc, tipo: tipo, serie: fecha, numero: numero, id: id, xml: xml, codigo: "0",
+		descripcion: fmt.Sprintf("El Resumen diario %s, ha sido aceptado", id)}
+	nombre, xmlCDR, err := s.firmante.construirCDR(d)
+	if err != nil {
+		return archivo{}, err
+	}
+	return archivo{nombre: nombre, datos: xmlCDR}, nil
+}
+
+func (s *simulador) getStatusTicket(ticket string) (string, error) {
+	s.mu.Lock()
+	cdrs, ok := s.tickets[ticket]
+	s.mu.Unlock()
+	if !ok {
+		return "", &faultSUNAT{"0127", "El ticket no existe"}
+	}
+	zipCDR, err := crearZip(cdrs)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<status><content>%s</content><statusCode>0</statusCode></status>", base64.StdEncoding.EncodeToString(zipCDR)), nil
+}
+
+// getStatusComprobante atiende getStatus y getStatusCdr de billConsultService.
+func (s *simulador) getStatusComprobante(op *etree.Element, conCDR bool) string {
+	clave := fmt.Sprintf("%s-%s-%s-%s", texto(op, "rucComprobante"), texto(op, "tipoComprobante"), texto(op, "serieComprobante"), texto(op, "numeroComprobante"))
+	s.mu.Lock()
+	reg, ok := s.registros[clave]
+	s.mu.Unlock()
+
+	nodo := "status"
+	if conCDR {
+		nodo = "statusCdr"
+	}
+	codigo, mensaje, contenido := "0011", "El comprobante de pago electrónico no existe.", ""
+	switch {
+	case ok && conCDR:
+		codigo, mensaje = "0004", "La constancia existe"
+		if zipCDR, err := crearZip([]archivo{reg.cdr}); err == nil {
+			contenido = fmt.Sprintf("<content>%s</content>", base64.StdEncoding.EncodeToString(zipCDR))
+		}
+	case ok && reg.aceptado:
+		codigo, mensaje = "0001", "El comprobante existe y está aceptado."
+	case ok:
+		codigo, mensaje = "0002", "El comprobante existe pero está rechazado."
+	}
+	return fmt.Sprintf("<%s>%s<statusCode>%s</statusCode><statusMessage>%s</statusMessage></%s>", nodo, contenido, codigo, mensaje, nodo)
+}
+
+// --- Administración del simulador ---
+
+func (s *simulador) listarEscenarios(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.escenarios.listar())
+}
+
+func (s *simulador) definirEscenario(w http.ResponseWriter, r *http.Request) {
+	var esc Escenario
+	if err := json.NewDecoder(r.Body).Decode(&esc); err != nil {
+		http.Error(w, "El cuerpo no es un JSON válido", http.StatusBadRequest)
+		return
+	}
+	if err := s.escenarios.definir(r.PathValue("documento"), esc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *simulador) reiniciar(w http.ResponseWriter, r *http.Request) {
+	s.escenarios.reiniciar()
+	s.mu.Lock()
+	s.registros = map[string]registro{}
+	s.tickets = map[string][]archivo{}
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Helpers ---
+
+// rucDelUsuario verifica que el RUC del archivo sea el del usuario (RUC + usuario SOL).
+func rucDelUsuario(usuario, ruc string) *faultSUNAT {
+	if len(usuario) > 11 && !strings.HasPrefix(usuario, ruc) {
+		return &faultSUNAT{"0154", "El RUC del archivo no corresponde al RUC del usuario"}
+	}
+	return nil
+}
+
+func abrirZip(contenidoBase64 string) ([]archivo, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(contenidoBase64))
+	if err != nil || len(data) == 0 {
+		return nil, &faultSUNAT{"0155", "El archivo ZIP está vacío"}
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, &faultSUNAT{"0156", "El archivo ZIP está corrupto"}
+	}
+	var archivos []archivo
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, &faultSUNAT{"0156", "El archivo ZIP está corrupto"}
+		}
+		datos, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, &faultSUNAT{"0156", "El archivo ZIP está corrupto"}
+		}
+		if len(datos) == 0 {
+			return nil, &faultSUNAT{"0160", "El archivo XML está vacío"}
+		}
+		archivos = append(archivos, archivo{nombre: f.Name, datos: datos})
+	}
+	if len(archivos) == 0 {
+		return nil, &faultSUNAT{"0157", "El archivo ZIP no contiene comprobantes"}
+	}
+	return archivos, nil
+}
+
+func responderSOAP(w http.ResponseWriter, cuerpo string) {
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/"><soap-env:Header/><soap-env:Body>%s</soap-env:Body></soap-env:Envelope>`, cuerpo)
+}
+
+// responderFault devuelve la excepción como lo hace SUNAT: HTTP 500 con el código en el faultcode.
+func responderFault(w http.ResponseWriter, f *faultSUNAT) {
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/"><soap-env:Header/><soap-env:Body><soap-env:Fault><faultcode>soap-env:Client.%s</faultcode><faultstring>%s</faultstring></soap-env:Fault></soap-env:Body></soap-env:Envelope>`, escapar(f.codigo), escapar(f.mensaje))
+}
+
+func escapar(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func texto(e *etree.Element, ruta string) string {
+	if hijo := e.FindElement(ruta); hijo != nil {
+		return strings.TrimSpace(hijo.Text())
+	}
+	return ""
+}
+
+func primero(valores ...string) string {
+	for _, v := range valores {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const usuarioPrueba = "20100066603MODDATOS"
+
+// firmantePrueba genera una clave y un certificado autofirmado para los CDR de las pruebas.
+func firmantePrueba(t *testing.T) *firmante {
+	t.Helper()
+	clave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plantilla := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "SUNAT simulada"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, plantilla, plantilla, &clave.PublicKey, clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &firmante{clave: clave, cert: cert}
+}
+
+func simuladorPrueba(t *testing.T, defecto Escenario) *simulador {
+	t.Helper()
+	return &simulador{
+		usuario:    "MODDATOS",
+		clave:      "moddatos",
+		escenarios: nuevosEscenarios(defecto),
+		firmante:   firmantePrueba(t),
+		registros:  map[string]registro{},
+		tickets:    map[string][]archivo{},
+	}
+}
+
+// llamar envía la operación SOAP al simulador y devuelve el código HTTP y el cuerpo.
+func llamar(s *simulador, usuario, clave, operacion, contenido string) (int, *etree.Document) {
+	sobre := fmt.Sprintf(`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ser="http://service.sunat.gob.pe" xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">`+
+		`<soapenv:Header><wsse:Security><wsse:UsernameToken><wsse:Username>%s</wsse:Username><wsse:Password>%s</wsse:Password></wsse:UsernameToken></wsse:Security></soapenv:Header>`+
+		`<soapenv:Body><ser:%s>%s</ser:%s></soapenv:Body></soapenv:Envelope>`, usuario, clave, operacion, contenido, operacion)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/billService", strings.NewReader(sobre)))
+	doc := etree.NewDocument()
+	doc.ReadFromBytes(rec.Body.Bytes())
+	return rec.Code, doc
+}
+
+// envio arma el cuerpo de sendBill o sendPack con los archivos indicados (nombre, contenido).
+func envio(t *testing.T, nombreZip string, archivos ...string) string {
+	t.Helper()
+	var lista []archivo
+	for i := 0; i+1 < len(archivos); i += 2 {
+		lista = append(lista, archivo{nombre: archivos[i], datos: []byte(archivos[i+1])})
+	}
+	data, err := crearZip(lista)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("<fileName>%s</fileName><contentFile>%s</contentFile>", nombreZip, base64.StdEncoding.EncodeToString(data))
+}
+
+// cdrsRespuesta abre el ZIP en base64 del nodo indicado y devuelve los CDR que contiene.
+func cdrsRespuesta(t *testing.T, doc *etree.Document, ruta string) []*etree.Document {
+	t.Helper()
+	nodo := doc.FindElement(ruta)
+	if nodo == nil {
+		t.Fatalf("la respuesta no tiene %s", ruta)
+	}
+	archivos, err := abrirZip(nodo.Text())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cdrs []*etree.Document
+	for _, a := range archivos {
+		cdr := etree.NewDocument()
+		if err := cdr.ReadFromBytes(a.datos); err != nil {
+			t.Fatalf("%s: %v", a.nombre, err)
+		}
+		cdrs = append(cdrs, cdr)
+	}
+	return cdrs
+}
+
+func faultcode(doc *etree.Document) string {
+	if doc.Root() == nil {
+		return ""
+	}
+	return texto(doc.Root(), "//Fault/faultcode")
+}
+
+func TestEscenarioValidar(t *testing.T) {
+	casos := []struct {
+		nombre string
+		esc    Escenario
+		valido bool
+	}{
+		{"aceptado", Escenario{Tipo: escenarioAceptado}, true},
+		{"lento sin código", Escenario{Tipo: escenarioLento, DemoraMs: 10}, true},
+		{"error500", Escenario{Tipo: escenarioError500}, true},
+		{"rechazado con código", Escenario{Tipo: escenarioRechazado, Codigo: "2017"}, true},
+		{"rechazado sin código", Escenario{Tipo: escenarioRechazado}, false},
+		{"observado sin código", Escenario{Tipo: escenarioObservado}, false},
+		{"fault sin código", Escenario{Tipo: escenarioFault}, false},
+		{"desconocido", Escenario{Tipo: "caido"}, false},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			if err := c.esc.validar(); (err == nil) != c.valido {
+				t.Errorf("validar() = %v, se esperaba válido=%v", err, c.valido)
+			}
+		})
+	}
+}
+
+func TestEscenarios(t *testing.T) {
+	e := nuevosEscenarios(Escenario{Tipo: escenarioAceptado})
+	if err := e.definir("F001-3", Escenario{Tipo: escenarioRechazado, Codigo: "2017"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.definir("*", Escenario{Tipo: escenarioObservado, Codigo: "4252"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.definir("F001-4", Escenario{Tipo: escenarioFault}); err == nil {
+		t.Error("se aceptó un escenario fault sin código")
+	}
+
+	if got := e.para("F001-3").Tipo; got != escenarioRechazado {
+		t.Errorf("F001-3: %s, se esperaba %s", got, escenarioRechazado)
+	}
+	if got := e.para("F001-9").Tipo; got != escenarioObservado {
+		t.Errorf("F001-9: %s, se esperaba el escenario por defecto %s", got, escenarioObservado)
+	}
+	if got := e.listar(); len(got) != 2 || got["*"].Tipo != escenarioObservado {
+		t.Errorf("listar() = %v", got)
+	}
+
+	e.reiniciar()
+	if got := e.para("F001-3").Tipo; got != escenarioAceptado {
+		t.Errorf("después de reiniciar F001-3 es %s, se esperaba %s", got, escenarioAceptado)
+	}
+}
+
+func TestAbrirZip(t *testing.T) {
+	codificar := func(archivos ...archivo) string {
+		data, err := crearZip(archivos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	var conDirectorio bytes.Buffer
+	zw := zip.NewWriter(&conDirectorio)
+	zw.Create("dummy/")
+	zw.Close()
+
+	casos := []struct {
+		nombre    string
+		contenido string
+		codigo    string // "" si debe abrirse
+	}{
+		{"un XML", codificar(archivo{"F001-1.xml", []byte("<Invoice/>")}), ""},
+		{"vacío", "", "0155"},
+		{"no es base64", "%%%", "0155"},
+		{"corrupto", base64.StdEncoding.EncodeToString([]byte("no es un zip")), "0156"},
+		{"solo directorios", base64.StdEncoding.EncodeToString(conDirectorio.Bytes()), "0157"},
+		{"XML vacío", codificar(archivo{"F001-1.xml", nil}), "0160"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			archivos, err := abrirZip(c.contenido)
+			if c.codigo == "" {
+				if err != nil || len(archivos) != 1 {
+					t.Fatalf("abrirZip = %d archivos, %v", len(archivos), err)
+				}
+				return
+			}
+			f, ok := err.(*faultSUNAT)
+			if !ok || f.codigo != c.codigo {
+				t.Errorf("abrirZip: %v, se esperaba el fault %s", err, c.codigo)
+			}
+		})
+	}
+}
+
+func TestAutenticar(t *testing.T) {
+	s := simuladorPrueba(t, Escenario{Tipo: escenarioAceptado})
+	casos := []struct {
+		nombre, usuario, clave, codigo string
+	}{
+		{"credenciales correctas", usuarioPrueba, "moddatos", ""},
+		{"sin usuario", "", "moddatos", "0101"},
+		{"usuario desconocido", "20100066603OTRO", "moddatos", "0103"},
+		{"clave incorrecta", usuarioPrueba, "otra", "0104"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			f := s.autenticar(c.usuario, c.clave)
+			switch {
+			case c.codigo == "" && f != nil:
+				t.Errorf("se rechazó: %v", f)
+			case c.codigo != "" && (f == nil || f.codigo != c.codigo):
+				t.Errorf("autenticar = %v, se esperaba %s", f, c.codigo)
+			}
+		})
+	}
+}
+
+func TestSendBill(t *testing.T) {
+	const xml = "<Invoice/>"
+	casos := []struct {
+		nombre    string
+		escenario Escenario
+		usuario   string
+		contenido func(t *testing.T) string
+		http      int
+		fault     string // faultcode esperado
+		respuesta string // ResponseCode esperado del CDR
+		nota      string
+	}{
+		{
+			nombre: "aceptado", escenario: Escenario{Tipo: escenarioAceptado}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string {
+				return envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", xml)
+			},
+			http: http.StatusOK, respuesta: "0",
+		},
+		{
+			nombre: "observado", escenario: Escenario{Tipo: escenarioObservado, Codigo: "4252", Mensaje: "El dato ingresado no cumple"}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string {
+				return envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", xml)
+			},
+			http: http.StatusOK, respuesta: "0", nota: "4252 - El dato ingresado no cumple",
+		},
+		{
+			nombre: "rechazado", escenario: Escenario{Tipo: escenarioRechazado, Codigo: "2017"}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string {
+				return envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", xml)
+			},
+			http: http.StatusOK, respuesta: "2017",
+		},
+		{
+			nombre: "fault", escenario: Escenario{Tipo: escenarioFault, Codigo: "0109"}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string {
+				return envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", xml)
+			},
+			http: http.StatusInternalServerError, fault: "soap-env:Client.0109",
+		},
+		{
+			nombre: "error500", escenario: Escenario{Tipo: escenarioError500}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string {
+				return envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", xml)
+			},
+			http: http.StatusInternalServerError,
+		},
+		{
+			nombre: "nombre de ZIP incorrecto", escenario: Escenario{Tipo: escenarioAceptado}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string { return envio(t, "F001-1.zip", "F001-1.xml", xml) },
+			http:      http.StatusInternalServerError, fault: "soap-env:Client.0151",
+		},
+		{
+			nombre: "RUC de otro emisor", escenario: Escenario{Tipo: escenarioAceptado}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string {
+				return envio(t, "20131312955-01-F001-1.zip", "20131312955-01-F001-1.xml", xml)
+			},
+			http: http.StatusInternalServerError, fault: "soap-env:Client.0154",
+		},
+		{
+			nombre: "XML con otro nombre", escenario: Escenario{Tipo: escenarioAceptado}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string {
+				return envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-2.xml", xml)
+			},
+			http: http.StatusInternalServerError, fault: "soap-env:Client.0161",
+		},
+		{
+			nombre: "dos XML", escenario: Escenario{Tipo: escenarioAceptado}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string {
+				return envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", xml, "20100066603-01-F001-2.xml", xml)
+			},
+			http: http.StatusInternalServerError, fault: "soap-env:Client.0158",
+		},
+		{
+			nombre: "XML mal formado", escenario: Escenario{Tipo: escenarioAceptado}, usuario: usuarioPrueba,
+			contenido: func(t *testing.T) string {
+				return envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", "<Invoice>")
+			},
+			http: http.StatusInternalServerError, fault: "soap-env:Client.0306",
+		},
+		{
+			nombre: "sin credenciales", escenario: Escenario{Tipo: escenarioAceptado},
+			contenido: func(t *testing.T) string {
+				return envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", xml)
+			},
+			http: http.StatusInternalServerError, fault: "soap-env:Client.0101",
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			s := simuladorPrueba(t, c.escenario)
+			codigo, doc := llamar(s, c.usuario, "moddatos", "sendBill", c.contenido(t))
+			if codigo != c.http {
+				t.Fatalf("HTTP %d, se esperaba %d", codigo, c.http)
+			}
+			if got := faultcode(doc); got != c.fault {
+				t.Fatalf("faultcode %q, se esperaba %q", got, c.fault)
+			}
+			if c.respuesta == "" {
+				return
+			}
+			cdrs := cdrsRespuesta(t, doc, "//sendBillResponse/applicationResponse")
+			if len(cdrs) != 1 {
+				t.Fatalf("%d CDR en la respuesta, se esperaba 1", len(cdrs))
+			}
+			raiz := cdrs[0].Root()
+			if got := texto(raiz, "//Response/ResponseCode"); got != c.respuesta {
+				t.Errorf("ResponseCode %q, se esperaba %q", got, c.respuesta)
+			}
+			if got := texto(raiz, "//Response/ReferenceID"); got != "F001-1" {
+				t.Errorf("ReferenceID %q", got)
+			}
+			if got := texto(raiz, "./Note"); got != c.nota {
+				t.Errorf("Note %q, se esperaba %q", got, c.nota)
+			}
+		})
+	}
+}
+
+func TestSendBillRepetido(t *testing.T) {
+	s := simuladorPrueba(t, Escenario{Tipo: escenarioAceptado})
+	cuerpo := envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", "<Invoice/>")
+	if codigo, _ := llamar(s, usuarioPrueba, "moddatos", "sendBill", cuerpo); codigo != http.StatusOK {
+		t.Fatalf("primer envío: HTTP %d", codigo)
+	}
+	_, doc := llamar(s, usuarioPrueba, "moddatos", "sendBill", cuerpo)
+	if got := faultcode(doc); got != "soap-env:Client.1033" {
+		t.Errorf("segundo envío: faultcode %q, se esperaba 1033", got)
+	}
+}
+
+func TestFirmaCDR(t *testing.T) {
+	s := simuladorPrueba(t, Escenario{Tipo: escenarioAceptado})
+	_, doc := llamar(s, usuarioPrueba, "moddatos", "sendBill", envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", "<Invoice/>"))
+	cdr := cdrsRespuesta(t, doc, "//applicationResponse")[0]
+
+	// La firma va dentro de ext:ExtensionContent, como en los CDR de SUNAT.
+	if cdr.FindElement("//ExtensionContent/Signature") == nil {
+		t.Fatal("el CDR no tiene la firma en ext:ExtensionContent")
+	}
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{s.firmante.cert}})
+	if _, err := ctx.Validate(cdr.Root()); err != nil {
+		t.Errorf("la firma del CDR no se valida con el certificado del simulador: %v", err)
+	}
+}
+
+func TestGetStatusCdr(t *testing.T) {
+	s := simuladorPrueba(t, Escenario{Tipo: escenarioAceptado})
+	if codigo, _ := llamar(s, usuarioPrueba, "moddatos", "sendBill", envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", "<Invoice/>")); codigo != http.StatusOK {
+		t.Fatalf("sendBill: HTTP %d", codigo)
+	}
+	consulta := func(numero string) string {
+		return "<rucComprobante>20100066603</rucComprobante><tipoComprobante>01</tipoComprobante>" +
+			"<serieComprobante>F001</serieComprobante><numeroComprobante>" + numero + "</numeroComprobante>"
+	}
+
+	_, doc := llamar(s, usuarioPrueba, "moddatos", "getStatusCdr", consulta("1"))
+	if got := texto(doc.Root(), "//statusCdr/statusCode"); got != "0004" {
+		t.Fatalf("statusCode %q, se esperaba 0004", got)
+	}
+	if cdrs := cdrsRespuesta(t, doc, "//statusCdr/content"); len(cdrs) != 1 {
+		t.Errorf("%d CDR en la consulta, se esperaba 1", len(cdrs))
+	}
+
+	_, doc = llamar(s, usuarioPrueba, "moddatos", "getStatus", consulta("1"))
+	if got := texto(doc.Root(), "//status/statusCode"); got != "0001" {
+		t.Errorf("getStatus: statusCode %q, se esperaba 0001", got)
+	}
+	_, doc = llamar(s, usuarioPrueba, "moddatos", "getStatusCdr", consulta("2"))
+	if got := texto(doc.Root(), "//statusCdr/statusCode"); got != "0011" {
+		t.Errorf("comprobante no enviado: statusCode %q, se esperaba 0011", got)
+	}
+}
+
+func TestSendPack(t *testing.T) {
+	s := simuladorPrueba(t, Escenario{Tipo: escenarioAceptado})
+	s.escenarios.definir("F001-2", Escenario{Tipo: escenarioFault, Codigo: "0109"})
+
+	cuerpo := envio(t, "20100066603-LT-20250107-1.zip",
+		"20100066603-01-F001-1.xml", "<Invoice/>",
+		"20100066603-01-F001-2.xml", "<Invoice/>")
+	codigo, doc := llamar(s, usuarioPrueba, "moddatos", "sendPack", cuerpo)
+	if codigo != http.StatusOK {
+		t.Fatalf("sendPack: HTTP %d, fault %q", codigo, faultcode(doc))
+	}
+	ticket := texto(doc.Root(), "//sendPackResponse/ticket")
+	if ticket == "" {
+		t.Fatal("sendPack no devolvió ticket")
+	}
+
+	_, doc = llamar(s, usuarioPrueba, "moddatos", "getStatus", "<ticket>"+ticket+"</ticket>")
+	cdrs := cdrsRespuesta(t, doc, "//status/content")
+	if len(cdrs) != 2 {
+		t.Fatalf("%d CDR en el ticket, se esperaba 2", len(cdrs))
+	}
+	// El fault de un comprobante dentro del lote llega como rechazo en su CDR.
+	codigos := map[string]string{}
+	for _, cdr := range cdrs {
+		codigos[texto(cdr.Root(), "//Response/ReferenceID")] = texto(cdr.Root(), "//Response/ResponseCode")
+	}
+	if codigos["F001-1"] != "0" || codigos["F001-2"] != "0109" {
+		t.Errorf("códigos por comprobante %v", codigos)
+	}
+
+	_, doc = llamar(s, usuarioPrueba, "moddatos", "getStatus", "<ticket>999</ticket>")
+	if got := faultcode(doc); got != "soap-env:Client.0127" {
+		t.Errorf("ticket inexistente: faultcode %q, se esperaba 0127", got)
+	}
+}
+
+func TestAdministracion(t *testing.T) {
+	s := simuladorPrueba(t, Escenario{Tipo: escenarioAceptado})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_mock/escenarios", s.listarEscenarios)
+	mux.HandleFunc("PUT /_mock/escenarios/{documento}", s.definirEscenario)
+	mux.HandleFunc("DELETE /_mock", s.reiniciar)
+
+	pedir := func(metodo, ruta, cuerpo string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(metodo, ruta, strings.NewReader(cuerpo)))
+		return rec.Code
+	}
+	if got := pedir(http.MethodPut, "/_mock/escenarios/F001-1", `{"tipo": "rechazado", "codigo": "2017"}`); got != http.StatusNoContent {
+		t.Errorf("PUT válido: HTTP %d", got)
+	}
+	if got := pedir(http.MethodPut, "/_mock/escenarios/F001-1", `{"tipo": "rechazado"}`); got != http.StatusBadRequest {
+		t.Errorf("PUT sin código: HTTP %d", got)
+	}
+	if got := pedir(http.MethodPut, "/_mock/escenarios/F001-1", `no es json`); got != http.StatusBadRequest {
+		t.Errorf("PUT con JSON inválido: HTTP %d", got)
+	}
+	if got := s.escenarios.para("F001-1"); got.Codigo != "2017" {
+		t.Errorf("escenario de F001-1 %+v", got)
+	}
+
+	llamar(s, usuarioPrueba, "moddatos", "sendBill", envio(t, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", "<Invoice/>"))
+	if got := pedir(http.MethodDelete, "/_mock", ""); got != http.StatusNoContent {
+		t.Errorf("DELETE: HTTP %d", got)
+	}
+	if len(s.registros) != 0 || s.escenarios.para("F001-1").Tipo != escenarioAceptado {
+		t.Errorf("DELETE no reinició el simulador: %d registros, escenario %+v", len(s.registros), s.escenarios.para("F001-1"))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"mi-conversor-ubl/catalogos"
+)
+
+var (
+	// Catálogo 25: código de producto SUNAT, según la clasificación UNSPSC v14_0801.
+	regexUNSPSC = regexp.MustCompile(`^[1-9][0-9]{7}$`)
+	regexGTIN   = regexp.MustCompile(`^([0-9]{8}|[0-9]{12,14})$`)
+)
+
+// Longitud máxima que SUNAT admite para el código de producto del emisor.
+const maxCodigoProducto = 30
+
+// validarCodigosProducto revisa el código interno, el código UNSPSC y el GTIN de cada línea.
+func validarCodigosProducto(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	for i, item := range d.Detalles {
+		ruta := fmt.Sprintf("$.detalles[%d]", i)
+		if len(item.CodigoProducto) > maxCodigoProducto {
+			v.agregarDetalle("4269", ruta+".codigoProducto", item.CodigoProducto)
+		}
+		if item.CodigoProductoSUNAT != "" && !codigoProductoSUNATValido(item.CodigoProductoSUNAT) {
+			v.agregarDetalle("3002", ruta+".codigoProductoSunat", item.CodigoProductoSUNAT)
+		}
+		if item.CodigoGTIN != "" && !gtinValido(item.CodigoGTIN) {
+			v.agregarDetalle("3003", ruta+".codigoGTIN", item.CodigoGTIN)
+		}
+	}
+}
+
+// codigoProductoSUNATValido comprueba el formato y que el segmento UNSPSC (los dos primeros
+// dígitos) figure en el catálogo 25. El catálogo incluido trae los segmentos completos pero
+// no las familias, clases ni productos, así que no se valida más allá del segmento.
+func codigoProductoSUNATValido(codigo string) bool {
+	return regexUNSPSC.MatchString(codigo) && catalogos.Valido(catalogos.ProductoSUNAT, codigo[:2]+"000000")
+}
+
+// gtinValido verifica la longitud y el dígito de control GS1 (módulo 10, pesos 3 y 1).
+func gtinValido(gtin string) bool {
+	if !regexGTIN.MatchString(gtin) {
+		return false
+	}
+	suma := 0
+	for i := len(gtin) - 2; i >= 0; i-- {
+		peso := 1
+		if (len(gtin)-2-i)%2 == 0 {
+			peso = 3
+		}
+		suma += int(gtin[i]-'0') * peso
+	}
+	return int(gtin[len(gtin)-1]-'0') == (10-suma%10)%10
+}
+
+// validarPropiedadesAdicionales revisa los datos sectoriales de cada línea contra el catálogo 55.
+func validarPropiedadesAdicionales(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	for i, item := range d.Detalles {
+		for j, prop := range item.PropiedadesAdicionales {
+			ruta := fmt.Sprintf("$.detalles[%d].propiedadesAdicionales[%d]", i, j)
+			v.validarCodigo(catalogos.PropiedadItem, prop.Codigo, "3071", ruta+".codigo")
+			if prop.Valor == "" && prop.FechaInicio == "" && prop.FechaFin == "" && prop.DuracionDias == 0 {
+				v.agregar("3072", ruta)
+			}
+			inicio, errInicio := time.Parse("2006-01-02", prop.FechaInicio)
+			if prop.FechaInicio != "" && errInicio != nil {
+				v.agregarDetalle("3073", ruta+".fechaInicio", prop.FechaInicio)
+			}
+			fin, errFin := time.Parse("2006-01-02", prop.FechaFin)
+			if prop.FechaFin != "" && errFin != nil {
+				v.agregarDetalle("3073", ruta+".fechaFin", prop.FechaFin)
+			}
+			if prop.FechaInicio != "" && prop.FechaFin != "" && errInicio == nil && errFin == nil && fin.Before(inicio) {
+				v.agregarDetalle("3073", ruta+".fechaFin", "la fecha de fin es anterior a la de inicio")
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+)
+
+const (
+	rutaConfiguracionPorDefecto = "./config.json"
+	// rucDemostracion es el RUC del certificado de demostración incluido en certs/.
+	rucDemostracion = "20601546913"
+)
+
+// Configuracion es el contenido del archivo indicado en SUNAT_CONFIG (por defecto ./config.json).
+type Configuracion struct {
+	// Entornos declara proveedores OSE o sobrescribe los entornos predefinidos.
+	Entornos map[string]Entorno `json:"entornos,omitempty"`
+	Emisores []ConfigEmisor     `json:"emisores"`
+	// Reintentos aplica a todos los emisores; los valores omitidos toman los por defecto.
+	Reintentos PoliticaReintentos `json:"reintentos,omitempty"`
+	// Plazos acota cada intento de llamada a SUNAT, distinto para envíos y consultas.
+	Plazos PlazosOperacion `json:"plazos,omitempty"`
+	// Transporte configura proxy, CA, TLS y pool de conexiones de las llamadas salientes.
+	Transporte ConfigTransporte `json:"transporte,omitempty"`
+	// Limites reparte las llamadas hacia cada endpoint: concurrencia, ritmo y espera en cola.
+	Limites ConfigLimites `json:"limites,omitempty"`
+	// Firma es el certificado de los emisores que no declaran uno propio; si se omite se usa
+	// el de demostración de ./certs, que solo sirve para el RUC de demostración.
+	Firma ConfigFirma `json:"firma,omitempty"`
+}
+
+// ConfigEmisor indica a qué entorno envía sus comprobantes cada RUC emisor y con qué
+// credenciales SOL. La clave conviene pasarla por variable de entorno o por un archivo de
+// secreto montado (claveSolArchivo) en lugar de escribirla en el archivo de configuración.
+type ConfigEmisor struct {
+	RUC             string  `json:"ruc"`
+	Entorno         string  `json:"entorno"`
+	UsuarioSOL      string  `json:"usuarioSol,omitempty"`
+	ClaveSOL        secreto `json:"claveSol,omitempty"`
+	ClaveSOLArchivo string  `json:"claveSolArchivo,omitempty"`
+	// Credenciales de las API REST de SUNAT (consulta de validez de comprobantes).
+	APIClientID            string  `json:"apiClientId,omitempty"`
+	APIClientSecret        secreto `json:"apiClientSecret,omitempty"`
+	APIClientSecretArchivo string  `json:"apiClientSecretArchivo,omitempty"`
+	// Firma es el certificado propio del emisor; sin él se usa el común. La clave del .pfx
+	// puede venir de SUNAT_CLAVE_PFX_<RUC> o SUNAT_CLAVE_PFX_ARCHIVO_<RUC>.
+	Firma *ConfigFirma `json:"firma,omitempty"`
+}
+
+// cargarConfiguracion lee el archivo de configuración. Si no existe, se usa un único
+// emisor en SUNAT beta (SUNAT_RUC o el RUC de demostración) para que el entorno de
+// desarrollo funcione sin configurar nada.
+func cargarConfiguracion() (*Configuracion, error) {
+	ruta := os.Getenv("SUNAT_CONFIG")
+	if ruta == "" {
+		ruta = rutaConfiguracionPorDefecto
+	}
+
+	data, err := os.ReadFile(ruta)
+	if errors.Is(err, fs.ErrNotExist) && os.Getenv("SUNAT_CONFIG") == "" {
+		ruc := primeroNoVacio(os.Getenv("SUNAT_RUC"), rucDemostracion)
+		return &Configuracion{Emisores: []ConfigEmisor{{RUC: ruc, Entorno: entornoBeta}}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer la configuración %s: %w", ruta, err)
+	}
+
+	var cfg Configuracion
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("la configuración %s no es un JSON válido: %w", ruta, err)
+	}
+	if len(cfg.Emisores) == 0 {
+		return nil, fmt.Errorf("la configuración %s no declara ningún emisor", ruta)
+	}
+	return &cfg, nil
+}
+
+// crearClientes arma un cliente de SUNAT por cada emisor configurado, indexado por RUC.
+func crearClientes(cfg *Configuracion) (map[string]*Client, error) {
+	clientes := make(map[string]*Client, len(cfg.Emisores))
+	sinConfianza := map[string]bool{}
+	// Todos los emisores archivan sus llamadas a SUNAT junto a los XML, en ./storage.
+	intercambios := &archivoIntercambios{dir: "./storage"}
+	// Todos comparten el transporte, y con él el pool de conexiones hacia cada servicio.
+	transporte, err := crearTransporte(cfg.Transporte)
+	if err != nil {
+		return nil, fmt.Errorf("transporte: %w", err)
+	}
+	httpClient := &http.Client{Transport: transporte}
+	limites := nuevosLimitadores(cfg.Limites)
+	for _, em := range cfg.Emisores {
+		if _, dup := clientes[em.RUC]; dup {
+			return nil, fmt.Errorf("el emisor %s está configurado más de una vez", em.RUC)
+		}
+		entorno, err := resolverEntorno(em.Entorno, cfg.Entornos)
+		if err != nil {
+			return nil, fmt.Errorf("emisor %s: %w", em.RUC, err)
+		}
+		cred, err := resolverCredenciales(em, entorno)
+		if err != nil {
+			return nil, fmt.Errorf("emisor %s: %w", em.RUC, err)
+		}
+		credAPI, err := resolverCredencialesAPI(em)
+		if err != nil {
+			return nil, fmt.Errorf("emisor %s: %w", em.RUC, err)
+		}
+		cliente := NewClient(entorno, em.RUC, cred)
+		cliente.Reintentos = cfg.Reintentos.completar()
+		cliente.Plazos = cfg.Plazos.completar()
+		cliente.API = credAPI
+		cliente.intercambios = intercambios
+		cliente.httpClient = httpClient
+		cliente.limites = limites
+		if cliente.confianzaCDR, err = cargarCertificados(entorno.CertificadosCDR); err != nil {
+			return nil, fmt.Errorf("emisor %s: %w", em.RUC, err)
+		}
+		if len(cliente.confianzaCDR) == 0 && !sinConfianza[entorno.Nombre] {
+			// Los entornos de SUNAT no traen sus certificados: hay que descargarlos y declararlos.
+			log.Printf("Atención: el entorno %s no tiene certificadosCdr; la firma de sus CDR no se verificará", entorno.Nombre)
+			sinConfianza[entorno.Nombre] = true
+		}
+		clientes[em.RUC] = cliente
+	}
+	return clientes, nil
+}
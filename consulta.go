@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/beevik/etree"
+)
+
+// ConsultaComprobante es la respuesta de billConsultService para un comprobante.
+type ConsultaComprobante struct {
+	// Codigo y Mensaje son el statusCode y statusMessage de SUNAT ("0001", "0011", ...).
+	Codigo  string `json:"codigo"`
+	Mensaje string `json:"mensaje"`
+	// CDR es la constancia registrada; solo la trae getStatusCdr y solo si existe.
+	CDR *CDR `json:"cdr,omitempty"`
+}
+
+// Códigos de estado de billConsultService.
+const (
+	estadoConsultaAceptado   = "0001"
+	estadoConsultaRechazado  = "0002"
+	estadoConsultaDeBaja     = "0003"
+	estadoConsultaConsultado = "0004" // getStatusCdr: la constancia existe
+)
+
+// Existe indica si SUNAT tiene registrado el comprobante, en cualquier estado.
+func (c *ConsultaComprobante) Existe() bool {
+	switch c.Codigo {
+	case estadoConsultaAceptado, estadoConsultaRechazado, estadoConsultaDeBaja, estadoConsultaConsultado:
+		return true
+	}
+	return c.CDR != nil
+}
+
+// ConsultarEstado pregunta a SUNAT (getStatus) si el comprobante existe y en qué estado está.
+func (c *Client) ConsultarEstado(ctx context.Context, ruc, tipo, serie, numero string) (*ConsultaComprobante, error) {
+	return c.consultar(ctx, "getStatus", "status", ruc, tipo, serie, numero)
+}
+
+// ConsultarCDR recupera de SUNAT (getStatusCdr) el CDR de un comprobante ya enviado, sin
+// reenviarlo. Si SUNAT no tiene el comprobante, la consulta vuelve sin CDR y sin error.
+func (c *Client) ConsultarCDR(ctx context.Context, ruc, tipo, serie, numero string) (*ConsultaComprobante, error) {
+	return c.consultar(ctx, "getStatusCdr", "statusCdr", ruc, tipo, serie, numero)
+}
+
+func (c *Client) consultar(ctx context.Context, operacion, nodoRespuesta, ruc, tipo, serie, numero string) (*ConsultaComprobante, error) {
+	if c.Entorno.URLConsulta == "" {
+		return nil, fmt.Errorf("el entorno %q no define urlConsulta", c.Entorno.Nombre)
+	}
+	cuerpo := fmt.Sprintf(`<ser:%s><rucComprobante>%s</rucComprobante><tipoComprobante>%s</tipoComprobante><serieComprobante>%s</serieComprobante><numeroComprobante>%s</numeroComprobante></ser:%s>`, operacion, ruc, tipo, serie, numero, operacion)
+	documento := fmt.Sprintf("%s-%s-%s-%s", ruc, tipo, serie, numero)
+	respBody, err := c.llamarSOAP(ctx, operacion, documento, c.Entorno.URLConsulta, sobreSOAP(c.Username, string(c.Password), cuerpo))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(respBody); err != nil {
+		return nil, fmt.Errorf("XML de respuesta SOAP mal formado: %w", err)
+	}
+	nodo := doc.FindElement("//" + nodoRespuesta)
+	if nodo == nil {
+		return nil, fmt.Errorf("no se encontró el nodo <%s> en la respuesta", nodoRespuesta)
+	}
+
+	consulta := &ConsultaComprobante{Codigo: textoDe(nodo, "statusCode"), Mensaje: textoDe(nodo, "statusMessage")}
+	if contenido := textoDe(nodo, "content"); contenido != "" {
+		cdr, err := leerZipCDR(contenido)
+		if err != nil {
+			return nil, err
+		}
+		consulta.CDR = cdr
+	}
+	return consulta, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// secreto es un valor sensible (clave SOL, client secret, contraseñas) que nunca se imprime:
+// fmt y encoding/json muestran "****" en su lugar. Para usarlo hay que convertirlo a string.
+type secreto string
+
+const textoRedactado = "****"
+
+func (s secreto) String() string   { return textoRedactado }
+func (s secreto) GoString() string { return textoRedactado }
+
+func (s secreto) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + textoRedactado + `"`), nil
+}
+
+// CredencialesSOL son el usuario y la clave SOL con que el emisor se autentica en el servicio.
+type CredencialesSOL struct {
+	Usuario string
+	Clave   secreto
+}
+
+// resolverCredenciales busca las credenciales SOL del emisor en este orden:
+//  1. variables de entorno SUNAT_USUARIO_SOL_<RUC> y SUNAT_CLAVE_SOL_<RUC>;
+//  2. archivo de secreto montado (SUNAT_CLAVE_SOL_ARCHIVO_<RUC> o "claveSolArchivo");
+//  3. los campos "usuarioSol" y "claveSol" del archivo de configuración;
+//  4. las credenciales públicas del entorno (MODDATOS en SUNAT beta).
+//
+// En producción y en un OSE no hay credenciales públicas: si faltan, es un error.
+func resolverCredenciales(em ConfigEmisor, entorno Entorno) (CredencialesSOL, error) {
+	usuario := primeroNoVacio(os.Getenv("SUNAT_USUARIO_SOL_"+em.RUC), em.UsuarioSOL)
+	clave, err := leerSecreto("SUNAT_CLAVE_SOL_"+em.RUC, "SUNAT_CLAVE_SOL_ARCHIVO_"+em.RUC, em.ClaveSOLArchivo, em.ClaveSOL)
+	if err != nil {
+		return CredencialesSOL{}, fmt.Errorf("no se pudo leer el secreto de la clave SOL: %w", err)
+	}
+
+	if usuario == "" && clave == "" && entorno.UsuarioPrueba != "" {
+		// Las credenciales de prueba son públicas: no se registran como secreto para no
+		// ocultar también el usuario en los logs.
+		return CredencialesSOL{Usuario: entorno.UsuarioPrueba, Clave: secreto(entorno.ClavePrueba)}, nil
+	}
+	if usuario == "" || clave == "" {
+		return CredencialesSOL{}, fmt.Errorf("faltan el usuario o la clave SOL para el entorno %q (defina SUNAT_USUARIO_SOL_%s y SUNAT_CLAVE_SOL_%s o un archivo de secreto)", entorno.Nombre, em.RUC, em.RUC)
+	}
+
+	registrarSecreto(clave)
+	return CredencialesSOL{Usuario: usuario, Clave: secreto(clave)}, nil
+}
+
+// CredencialesAPI son el client_id y client_secret que SUNAT entrega para sus API REST
+// (consulta de validez de comprobantes), distintos de la clave SOL.
+type CredencialesAPI struct {
+	ClientID     string
+	ClientSecret secreto
+}
+
+// resolverCredencialesAPI busca las credenciales de las API REST de SUNAT con la misma
+// precedencia que las SOL: SUNAT_API_CLIENT_ID_<RUC> y SUNAT_API_CLIENT_SECRET_<RUC>, el
+// archivo de secreto (SUNAT_API_CLIENT_SECRET_ARCHIVO_<RUC> o "apiClientSecretArchivo") y los
+// campos del archivo de configuración. Son opcionales: sin ellas no se puede consultar la validez.
+func resolverCredencialesAPI(em ConfigEmisor) (CredencialesAPI, error) {
+	id := primeroNoVacio(os.Getenv("SUNAT_API_CLIENT_ID_"+em.RUC), em.APIClientID)
+	clave, err := leerSecreto("SUNAT_API_CLIENT_SECRET_"+em.RUC, "SUNAT_API_CLIENT_SECRET_ARCHIVO_"+em.RUC, em.APIClientSecretArchivo, em.APIClientSecret)
+	if err != nil {
+		return CredencialesAPI{}, fmt.Errorf("no se pudo leer el secreto de la API de SUNAT: %w", err)
+	}
+	if (id == "") != (clave == "") {
+		return CredencialesAPI{}, fmt.Errorf("las credenciales de la API de SUNAT necesitan client_id y client_secret")
+	}
+	registrarSecreto(clave)
+	return CredencialesAPI{ClientID: id, ClientSecret: secreto(clave)}, nil
+}
+
+// leerSecreto toma el valor de la variable de entorno, del archivo de secreto montado (la
+// ruta sale de la variable o de la configuración) o, en último caso, de la configuración.
+func leerSecreto(variable, variableArchivo, archivoConfig string, valorConfig secreto) (string, error) {
+	if v := os.Getenv(variable); v != "" {
+		return v, nil
+	}
+	if archivo := primeroNoVacio(os.Getenv(variableArchivo), archivoConfig); archivo != "" {
+		data, err := os.ReadFile(archivo)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return string(valorConfig), nil
+}
+
+func primeroNoVacio(valores ...string) string {
+	for _, v := range valores {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// --- Redacción de secretos en logs y mensajes de error ---
+
+var (
+	secretosMu sync.RWMutex
+	secretos   []string
+
+	regexPasswordWSSE = regexp.MustCompile(`(<(?:\w+:)?Password\b[^>]*>)[^<]*(</(?:\w+:)?Password>)`)
+)
+
+// registrarSecreto agrega un valor a la lista de textos que redactar() reemplaza. Registrar
+// de nuevo el mismo valor, como hace cada recarga del certificado, no lo duplica.
+func registrarSecreto(valor string) {
+	if valor == "" {
+		return
+	}
+	secretosMu.Lock()
+	defer secretosMu.Unlock()
+	if !slices.Contains(secretos, valor) {
+		secretos = append(secretos, valor)
+	}
+}
+
+// redactar oculta los secretos registrados y el contenido de cualquier wsse:Password.
+func redactar(texto string) string {
+	texto = redactarPasswordWSSE(texto)
+	secretosMu.RLock()
+	defer secretosMu.RUnlock()
+	for _, s := range secretos {
+		texto = strings.ReplaceAll(texto, s, textoRedactado)
+	}
+	return texto
+}
+
+// redactarPasswordWSSE oculta solo el contenido de los wsse:Password. Sirve para los sobres
+// SOAP, donde reemplazar los secretos registrados en cualquier parte podría alterar el ZIP
+// en base64 si por casualidad contiene uno de ellos.
+func redactarPasswordWSSE(texto string) string {
+	return regexPasswordWSSE.ReplaceAllString(texto, "${1}"+textoRedactado+"${2}")
+}
+
+// escritorRedactado envuelve la salida del log para que ninguna línea muestre un secreto.
+type escritorRedactado struct {
+	destino io.Writer
+}
+
+func (e escritorRedactado) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(e.destino, redactar(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
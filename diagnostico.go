@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// servicioDiagnostico es un endpoint que usa al menos un emisor configurado.
+type servicioDiagnostico struct {
+	nombre   string
+	url      string
+	cliente  *Client
+	emisores []string
+}
+
+// serviciosConfigurados enumera, sin repetir, los endpoints de los emisores: billService,
+// guías, retenciones y consulta, y las API REST si el emisor tiene sus credenciales.
+func serviciosConfigurados(clientes map[string]*Client) []*servicioDiagnostico {
+	rucs := make([]string, 0, len(clientes))
+	for ruc := range clientes {
+		rucs = append(rucs, ruc)
+	}
+	slices.Sort(rucs)
+
+	var servicios []*servicioDiagnostico
+	porURL := map[string]*servicioDiagnostico{}
+	agregar := func(c *Client, nombre, url string) {
+		if url == "" {
+			return
+		}
+		if s, ok := porURL[url]; ok {
+			s.emisores = append(s.emisores, c.RUC)
+			return
+		}
+		s := &servicioDiagnostico{nombre: nombre, url: url, cliente: c, emisores: []string{c.RUC}}
+		porURL[url] = s
+		servicios = append(servicios, s)
+	}
+	for _, ruc := range rucs {
+		c := clientes[ruc]
+		agregar(c, "facturas", wsdl(c.Entorno.URLFacturas))
+		agregar(c, "guías", wsdl(c.Entorno.URLGuias))
+		agregar(c, "retenciones", wsdl(c.Entorno.URLRetenciones))
+		agregar(c, "consulta", wsdl(c.Entorno.URLConsulta))
+		if c.API.ClientID != "" {
+			agregar(c, "api-seguridad", primeroNoVacio(c.Entorno.URLAPISeguridad, urlAPISeguridadSUNAT))
+			agregar(c, "api", primeroNoVacio(c.Entorno.URLAPI, urlAPISUNAT))
+		}
+	}
+	return servicios
+}
+
+// wsdl devuelve la URL del WSDL de un servicio SOAP, o "" si el entorno no lo define.
+func wsdl(url string) string {
+	if url == "" {
+		return ""
+	}
+	return url + "?wsdl"
+}
+
+// diagnosticar prueba la conexión con cada servicio configurado a través del mismo
+// transporte que usa el servidor (proxy, CA, versión de TLS) e imprime una línea por
+// servicio. Una respuesta HTTP cuenta como conexión exitosa salvo las que indica
+// fallaHTTP. Devuelve false si algún servicio falló.
+func diagnosticar(ctx context.Context, clientes map[string]*Client, salida io.Writer) bool {
+	tw := tabwriter.NewWriter(salida, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULTADO\tSERVICIO\tURL\tHTTP\tTLS\tEMISOR DEL CERTIFICADO\tTIEMPO\tEMISORES")
+	todoBien := true
+	for _, s := range serviciosConfigurados(clientes) {
+		estado, version, certificado, duracion, err := probarServicio(ctx, s.cliente, s.url)
+		resultado, detalle := "OK", fmt.Sprint(estado)
+		switch {
+		case err != nil:
+			todoBien = false
+			resultado, detalle = "FALLA", redactar(err.Error())
+		case fallaHTTP(estado) != "":
+			todoBien = false
+			resultado, detalle = "FALLA", fmt.Sprintf("%d (%s)", estado, fallaHTTP(estado))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", resultado, s.nombre, s.url, detalle, version, certificado, duracion.Round(time.Millisecond), strings.Join(s.emisores, ","))
+	}
+	tw.Flush()
+	return todoBien
+}
+
+// fallaHTTP explica por qué el estado HTTP indica que el servicio no es alcanzable, o
+// devuelve "" si la respuesta prueba que la conexión llegó. Un 404 o 405 sí cuenta como
+// conexión: el GET llega al servicio aunque este solo atienda POST. El 403 suele venir de
+// un proxy o firewall que bloquea el destino, y los 5xx de un servicio caído o de una
+// pasarela (502, 503, 504) que no pudo llegar a SUNAT.
+func fallaHTTP(estado int) string {
+	switch {
+	case estado == http.StatusProxyAuthRequired:
+		return "el proxy rechazó las credenciales"
+	case estado == http.StatusForbidden:
+		return "acceso prohibido, probablemente por el proxy o un firewall"
+	case estado == http.StatusBadGateway || estado == http.StatusServiceUnavailable || estado == http.StatusGatewayTimeout:
+		return "el servicio o la pasarela no responde"
+	case estado >= 500:
+		return "error del servidor"
+	}
+	return ""
+}
+
+func probarServicio(ctx context.Context, c *Client, url string) (estado int, version, certificado string, duracion time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.Plazos.ConsultaMs)*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, "-", "-", 0, err
+	}
+
+	inicio := time.Now()
+	resp, err := c.httpClient.Do(req)
+	duracion = time.Since(inicio)
+	if err != nil {
+		return 0, "-", "-", duracion, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	version, certificado = "-", "-"
+	if resp.TLS != nil {
+		version = tls.VersionName(resp.TLS.Version)
+		if len(resp.TLS.PeerCertificates) > 0 {
+			// Con un proxy que inspecciona TLS aquí aparece su CA y no la de SUNAT.
+			certificado = resp.TLS.PeerCertificates[0].Issuer.CommonName
+		}
+	}
+	return resp.StatusCode, version, certificado, duracion, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiagnosticar(t *testing.T) {
+	casos := []struct {
+		nombre string
+		estado int
+		ok     bool
+	}{
+		{"WSDL disponible", http.StatusOK, true},
+		{"servicio que solo atiende POST", http.StatusMethodNotAllowed, true},
+		{"ruta desconocida", http.StatusNotFound, true},
+		{"credenciales del proxy", http.StatusProxyAuthRequired, false},
+		{"bloqueado por el proxy", http.StatusForbidden, false},
+		{"error del servidor", http.StatusInternalServerError, false},
+		{"pasarela sin respuesta", http.StatusBadGateway, false},
+		{"servicio no disponible", http.StatusServiceUnavailable, false},
+		{"plazo de la pasarela", http.StatusGatewayTimeout, false},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.estado)
+			}))
+			defer srv.Close()
+
+			var salida bytes.Buffer
+			ok := diagnosticar(context.Background(), map[string]*Client{"20100066603": clientePrueba(srv.URL + "/billService")}, &salida)
+			if ok != c.ok {
+				t.Errorf("diagnosticar = %v, se esperaba %v:\n%s", ok, c.ok, salida.String())
+			}
+			lineas := strings.Split(strings.TrimSpace(salida.String()), "\n")
+			// Encabezado, facturas y consulta (en clientePrueba comparten la URL).
+			if len(lineas) != 2 {
+				t.Fatalf("se esperaban el encabezado y un servicio:\n%s", salida.String())
+			}
+			esperado := "OK"
+			if !c.ok {
+				esperado = "FALLA"
+			}
+			if !strings.HasPrefix(lineas[1], esperado) || !strings.Contains(lineas[1], "billService?wsdl") {
+				t.Errorf("línea del servicio %q, se esperaba %s", lineas[1], esperado)
+			}
+		})
+	}
+}
+
+func TestDiagnosticarSinConexion(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	var salida bytes.Buffer
+	if diagnosticar(context.Background(), map[string]*Client{"20100066603": clientePrueba(url)}, &salida) {
+		t.Errorf("un servicio que no acepta conexiones no puede dar OK:\n%s", salida.String())
+	}
+}
+
+func TestServiciosConfigurados(t *testing.T) {
+	a := clientePrueba("http://sunat/billService")
+	a.Entorno.URLConsulta = "http://sunat/billConsultService"
+	b := clientePrueba("http://sunat/billService")
+	b.RUC = "20131312955"
+	b.Entorno.URLConsulta = "http://sunat/billConsultService"
+	b.Entorno.URLGuias = "http://sunat/guias"
+
+	servicios := serviciosConfigurados(map[string]*Client{"20131312955": b, "20100066603": a})
+	var resumen []string
+	for _, s := range servicios {
+		resumen = append(resumen, s.nombre+" "+s.url+" "+strings.Join(s.emisores, ","))
+	}
+	esperado := []string{
+		"facturas http://sunat/billService?wsdl 20100066603,20131312955",
+		"consulta http://sunat/billConsultService?wsdl 20100066603,20131312955",
+		"guías http://sunat/guias?wsdl 20131312955",
+	}
+	if strings.Join(resumen, "\n") != strings.Join(esperado, "\n") {
+		t.Errorf("serviciosConfigurados:\n%s\nse esperaba:\n%s", strings.Join(resumen, "\n"), strings.Join(esperado, "\n"))
+	}
+}
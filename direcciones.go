@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"mi-conversor-ubl/catalogos"
+)
+
+var regexUbigeo = regexp.MustCompile(`^[0-9]{6}$`)
+
+// completarDirecciones llena departamento, provincia y distrito a partir del ubigeo
+// cuando el cliente los envía vacíos, y los lleva a la grafía del catálogo cuando solo
+// difieren en mayúsculas o tildes. Los que no coinciden se dejan para que validarUbigeos
+// los rechace.
+func completarDirecciones(d *DocumentoElectronico) {
+	completarDireccion(&d.Emisor.Direccion)
+	completarDireccion(&d.Receptor.Direccion)
+}
+
+func completarDireccion(dir *Direccion) {
+	u, ok := catalogos.BuscarUbigeo(dir.Ubigeo)
+	if !ok {
+		return
+	}
+	normalizar := func(campo *string, valor string) {
+		if *campo == "" || catalogos.MismoNombre(*campo, valor) {
+			*campo = valor
+		}
+	}
+	normalizar(&dir.Departamento, u.Departamento)
+	normalizar(&dir.Provincia, u.Provincia)
+	normalizar(&dir.Distrito, u.Distrito)
+}
+
+// validarUbigeos comprueba que el ubigeo exista y que los nombres coincidan con el catálogo del INEI.
+func validarUbigeos(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	validarUbigeo(d.Emisor.Direccion, "$.emisor.direccion", v)
+	validarUbigeo(d.Receptor.Direccion, "$.receptor.direccion", v)
+}
+
+func validarUbigeo(dir Direccion, ruta string, v *validacion) {
+	if dir.Ubigeo == "" {
+		return
+	}
+	u, ok := catalogos.BuscarUbigeo(dir.Ubigeo)
+	if !ok {
+		validarUbigeoDesconocido(dir, ruta, v)
+		return
+	}
+	campos := []struct{ campo, informado, esperado string }{
+		{"departamento", dir.Departamento, u.Departamento},
+		{"provincia", dir.Provincia, u.Provincia},
+		{"distrito", dir.Distrito, u.Distrito},
+	}
+	for _, c := range campos {
+		if !catalogos.MismoNombre(c.informado, c.esperado) {
+			v.agregarDetalle("2776", ruta+"."+c.campo, fmt.Sprintf("el ubigeo %s corresponde a %s y se informó %q", dir.Ubigeo, c.esperado, c.informado))
+		}
+	}
+}
+
+// validarUbigeoDesconocido rechaza un ubigeo que no está en el catálogo. Con la copia parcial
+// podría ser un ubigeo vigente que falta en el archivo, y el mensaje indica cómo agregarlo.
+func validarUbigeoDesconocido(dir Direccion, ruta string, v *validacion) {
+	if catalogos.UbigeosCompletos() || !regexUbigeo.MatchString(dir.Ubigeo) {
+		v.agregarDetalle("2775", ruta+".ubigeo", dir.Ubigeo)
+		return
+	}
+	v.agregarDetalle("2775", ruta+".ubigeo", fmt.Sprintf("%s no figura en la copia parcial del padrón del INEI; si es un ubigeo vigente, agréguelo a catalogos/datos/inei/ubigeos.tsv", dir.Ubigeo))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	tipoDocDNI       = "1"
+	tipoDocCarnet    = "4"
+	tipoDocPasaporte = "7"
+	tipoDocVarios    = "-"
+)
+
+var (
+	regexDNI = regexp.MustCompile(`^[0-9]{8}$`)
+	regexRUC = regexp.MustCompile(`^(10|15|17|20)[0-9]{9}$`)
+	// Carnet de extranjería y pasaporte: alfanuméricos de hasta 12 caracteres.
+	regexDocExtranjero = regexp.MustCompile(`^[A-Za-z0-9]{1,12}$`)
+	// El resto de documentos del catálogo 06 admite hasta 15 caracteres.
+	regexDocOtros = regexp.MustCompile(`^[A-Za-z0-9-]{1,15}$`)
+
+	// Monto a partir del cual una boleta debe identificar al adquiriente.
+	montoBoletaIdentificada = decimal.NewFromInt(700)
+	pesosRUC                = []int{5, 4, 3, 2, 7, 6, 5, 4, 3, 2}
+)
+
+// ValidarRUC verifica la longitud, el prefijo y el dígito verificador (módulo 11) de un RUC.
+func ValidarRUC(ruc string) error {
+	if !regexRUC.MatchString(ruc) {
+		return fmt.Errorf("el RUC debe tener 11 dígitos y empezar con 10, 15, 17 o 20")
+	}
+	if dv := digitoVerificadorRUC(ruc); int(ruc[10]-'0') != dv {
+		return fmt.Errorf("el dígito verificador del RUC no es válido (se esperaba %d)", dv)
+	}
+	return nil
+}
+
+func digitoVerificadorRUC(ruc string) int {
+	suma := 0
+	for i, peso := range pesosRUC {
+		suma += int(ruc[i]-'0') * peso
+	}
+	dv := 11 - suma%11
+	switch dv {
+	case 10:
+		return 0
+	case 11:
+		return 1
+	}
+	return dv
+}
+
+// ValidarNumeroDocumento aplica al número las reglas del tipo de documento de identidad (catálogo 06).
+func ValidarNumeroDocumento(tipo, numero string) error {
+	switch tipo {
+	case tipoDocRUC:
+		return ValidarRUC(numero)
+	case tipoDocDNI:
+		if !regexDNI.MatchString(numero) {
+			return fmt.Errorf("el DNI debe tener 8 dígitos")
+		}
+	case tipoDocCarnet, tipoDocPasaporte:
+		if !regexDocExtranjero.MatchString(numero) {
+			return fmt.Errorf("el documento debe ser alfanumérico de hasta 12 caracteres")
+		}
+	case tipoDocVarios:
+		return nil
+	default:
+		if !regexDocOtros.MatchString(numero) {
+			return fmt.Errorf("el documento debe ser alfanumérico de hasta 15 caracteres")
+		}
+	}
+	return nil
+}
+
+// validarDocumentosIdentidad revisa el número de documento del emisor y del receptor.
+func validarDocumentosIdentidad(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	switch {
+	case d.Emisor.TipoDocIdentidad != tipoDocRUC:
+		v.agregarDetalle("2014", "$.emisor.tipoDocIdentidad", d.Emisor.TipoDocIdentidad)
+	case v.entorno == entornoBeta && regexRUC.MatchString(d.Emisor.RUC):
+		// SUNAT beta acepta RUC de prueba sin dígito verificador válido, como el del
+		// certificado de demostración; en cualquier otro entorno se exige completo.
+	default:
+		if err := ValidarRUC(d.Emisor.RUC); err != nil {
+			v.agregarDetalle("2014", "$.emisor.ruc", err.Error())
+		}
+	}
+
+	err := ValidarNumeroDocumento(d.Receptor.TipoDocIdentidad, d.Receptor.RUC)
+	if err == nil {
+		return
+	}
+	codigo := map[string]string{tipoDocRUC: "2017", tipoDocDNI: "2801"}[d.Receptor.TipoDocIdentidad]
+	if codigo == "" {
+		codigo = "2802"
+	}
+	v.agregarDetalle(codigo, "$.receptor.ruc", err.Error())
+}
+
+// validarBoletaIdentificada exige identificar al adquiriente en boletas mayores a S/ 700.00.
+// Una boleta en otra moneda se convierte con tipoCambio; sin él no se sabe si supera el tope,
+// así que se exige identificar al adquiriente igual.
+func validarBoletaIdentificada(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	if d.TipoDocumento != tipoBoleta {
+		return
+	}
+	numero := strings.Trim(d.Receptor.RUC, "0- ")
+	if d.Receptor.TipoDocIdentidad != tipoDocVarios && numero != "" {
+		return
+	}
+	detalle := fmt.Sprintf("importe total %s", d.TotalGeneral.StringFixed(2))
+	importe := d.TotalGeneral
+	if d.Moneda != "PEN" {
+		if !d.TipoCambio.IsPositive() {
+			v.agregarDetalle("2015", "$.receptor", fmt.Sprintf("importe total %s %s sin tipoCambio para convertirlo a soles", d.Moneda, d.TotalGeneral.StringFixed(2)))
+			return
+		}
+		importe = d.TotalGeneral.Mul(d.TipoCambio)
+		detalle = fmt.Sprintf("importe total %s %s, S/ %s al tipo de cambio %s", d.Moneda, d.TotalGeneral.StringFixed(2), importe.StringFixed(2), d.TipoCambio.String())
+	}
+	if importe.GreaterThan(montoBoletaIdentificada) {
+		v.agregarDetalle("2015", "$.receptor", detalle)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestDigitoVerificadorRUC(t *testing.T) {
+	casos := []struct {
+		ruc string
+		dv  int
+	}{
+		{"20100066603", 3},
+		{"20131312955", 5},
+		{"20601546913", 5},
+		{"10001000000", 0}, // 11 - suma%11 = 10
+		{"10000100001", 1}, // 11 - suma%11 = 11
+	}
+	for _, c := range casos {
+		if dv := digitoVerificadorRUC(c.ruc); dv != c.dv {
+			t.Errorf("digitoVerificadorRUC(%q) = %d, se esperaba %d", c.ruc, dv, c.dv)
+		}
+	}
+}
+
+func TestValidarRUC(t *testing.T) {
+	casos := []struct {
+		ruc    string
+		valido bool
+	}{
+		{"20100066603", true},
+		{"20131312955", true},
+		{"10001000000", true},
+		{"10000100001", true},
+		{"20601546913", false}, // RUC del certificado de demostración
+		{"30100066603", false},
+		{"2010006660", false},
+		{"201000666031", false},
+		{"2010006660A", false},
+		{"", false},
+	}
+	for _, c := range casos {
+		if err := ValidarRUC(c.ruc); (err == nil) != c.valido {
+			t.Errorf("ValidarRUC(%q) = %v, se esperaba válido %t", c.ruc, err, c.valido)
+		}
+	}
+}
+
+func TestValidarBoletaIdentificada(t *testing.T) {
+	casos := []struct {
+		nombre     string
+		moneda     string
+		total      string
+		tipoCambio string
+		tipoDoc    string
+		error      bool
+	}{
+		{nombre: "soles bajo el tope", moneda: "PEN", total: "700.00", tipoDoc: tipoDocVarios},
+		{nombre: "soles sobre el tope", moneda: "PEN", total: "700.01", tipoDoc: tipoDocVarios, error: true},
+		{nombre: "soles sobre el tope identificada", moneda: "PEN", total: "1500.00", tipoDoc: tipoDocDNI},
+		{nombre: "dólares bajo el tope", moneda: "USD", total: "150.00", tipoCambio: "3.750", tipoDoc: tipoDocVarios},
+		{nombre: "dólares sobre el tope", moneda: "USD", total: "200.00", tipoCambio: "3.750", tipoDoc: tipoDocVarios, error: true},
+		{nombre: "dólares sin tipo de cambio", moneda: "USD", total: "10.00", tipoDoc: tipoDocVarios, error: true},
+		{nombre: "dólares sin tipo de cambio identificada", moneda: "USD", total: "10.00", tipoDoc: tipoDocDNI},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			d := &DocumentoElectronico{TipoDocumento: tipoBoleta, Moneda: c.moneda, TotalGeneral: decimal.RequireFromString(c.total)}
+			if c.tipoCambio != "" {
+				d.TipoCambio = decimal.RequireFromString(c.tipoCambio)
+			}
+			d.Receptor.TipoDocIdentidad = c.tipoDoc
+			if c.tipoDoc == tipoDocDNI {
+				d.Receptor.RUC = "45678912"
+			}
+			v := &validacion{}
+			validarBoletaIdentificada(d, time.Time{}, v)
+			if got := len(v.resultado) > 0; got != c.error {
+				t.Errorf("se obtuvo %+v, se esperaba error %t", v.resultado, c.error)
+			}
+		})
+	}
+}
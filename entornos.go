@@ -0,0 +1,80 @@
+package main
+
+import "fmt"
+
+// Entorno agrupa los endpoints de un proveedor de servicios (SUNAT o un OSE) y sus reglas
+// de credenciales. Los entornos "beta" y "produccion" vienen predefinidos; los OSE se
+// declaran en la configuración con el nombre que se quiera.
+type Entorno struct {
+	Nombre string `json:"-"`
+	// URLFacturas atiende facturas, boletas, notas y resúmenes (billService).
+	URLFacturas string `json:"urlFacturas"`
+	// URLGuias atiende las guías de remisión.
+	URLGuias string `json:"urlGuias,omitempty"`
+	// URLRetenciones atiende comprobantes de retención y percepción.
+	URLRetenciones string `json:"urlRetenciones,omitempty"`
+	// URLConsulta atiende getStatus y getStatusCdr (billConsultService).
+	URLConsulta string `json:"urlConsulta,omitempty"`
+	// UsuarioConRUC indica que el usuario del WS-Security es RUC + usuario SOL, como en
+	// SUNAT. Muchos OSE entregan un usuario propio que se envía tal cual.
+	UsuarioConRUC bool `json:"usuarioConRuc"`
+	// UsuarioPrueba y ClavePrueba son las credenciales públicas del entorno, si las tiene.
+	// Solo se usan cuando el emisor no configura las suyas.
+	UsuarioPrueba string `json:"usuarioPrueba,omitempty"`
+	ClavePrueba   string `json:"clavePrueba,omitempty"`
+	// URLAPISeguridad y URLAPI son la base del servidor de tokens OAuth2 y de las API REST.
+	// SUNAT publica una sola instancia, así que si se omiten se usan las de producción.
+	URLAPISeguridad string `json:"urlApiSeguridad,omitempty"`
+	URLAPI          string `json:"urlApi,omitempty"`
+	// CertificadosCDR son archivos PEM con los certificados con que el servicio firma sus
+	// CDR. Si se indican, un CDR con firma inválida o de otro certificado se rechaza.
+	CertificadosCDR []string `json:"certificadosCdr,omitempty"`
+}
+
+const (
+	urlAPISeguridadSUNAT = "https://api-seguridad.sunat.gob.pe"
+	urlAPISUNAT          = "https://api.sunat.gob.pe"
+)
+
+const (
+	entornoBeta       = "beta"
+	entornoProduccion = "produccion"
+)
+
+// entornosPredefinidos son los servicios publicados por SUNAT.
+var entornosPredefinidos = map[string]Entorno{
+	entornoBeta: {
+		Nombre:         entornoBeta,
+		URLFacturas:    "https://e-beta.sunat.gob.pe/ol-ti-itcpfegem-beta/billService",
+		URLGuias:       "https://e-beta.sunat.gob.pe/ol-ti-itemision-guia-gem-beta/billService",
+		URLRetenciones: "https://e-beta.sunat.gob.pe/ol-ti-itemision-otroscpe-gem-beta/billService",
+		URLConsulta:    "https://e-beta.sunat.gob.pe/ol-it-wsconscpegem-beta/billConsultService",
+		UsuarioConRUC:  true,
+		UsuarioPrueba:  "MODDATOS",
+		ClavePrueba:    "MODDATOS",
+	},
+	entornoProduccion: {
+		Nombre:         entornoProduccion,
+		URLFacturas:    "https://e-factura.sunat.gob.pe/ol-ti-itcpfegem/billService",
+		URLGuias:       "https://e-guiaremision.sunat.gob.pe/ol-ti-itemision-guia-gem/billService",
+		URLRetenciones: "https://e-factura.sunat.gob.pe/ol-ti-itemision-otroscpe-gem/billService",
+		URLConsulta:    "https://e-factura.sunat.gob.pe/ol-it-wsconscpegem/billConsultService",
+		UsuarioConRUC:  true,
+	},
+}
+
+// resolverEntorno busca el entorno por nombre, primero entre los declarados en la
+// configuración (que pueden sobrescribir a los predefinidos) y luego entre los de SUNAT.
+func resolverEntorno(nombre string, declarados map[string]Entorno) (Entorno, error) {
+	if e, ok := declarados[nombre]; ok {
+		e.Nombre = nombre
+		if e.URLFacturas == "" {
+			return Entorno{}, fmt.Errorf("el entorno %q no define urlFacturas", nombre)
+		}
+		return e, nil
+	}
+	if e, ok := entornosPredefinidos[nombre]; ok {
+		return e, nil
+	}
+	return Entorno{}, fmt.Errorf("el entorno %q no existe; use %q, %q o declárelo en \"entornos\"", nombre, entornoBeta, entornoProduccion)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+
+	"mi-conversor-ubl/catalogos"
+)
+
+// ErrorSUNAT es un SOAP fault de SUNAT o del OSE ya interpretado.
+type ErrorSUNAT struct {
+	// Codigo es el código de retorno de 4 dígitos ("0102", "1033", "2335").
+	Codigo string
+	// Mensaje es la descripción oficial del código; si no está en el catálogo, el faultstring.
+	Mensaje string
+	// FaultCode y FaultString son los valores recibidos, tal cual.
+	FaultCode   string
+	FaultString string
+	// EstadoHTTP es el estado de la respuesta que trajo el fault.
+	EstadoHTTP int
+	// Reintentable indica que el fallo es del servicio y el mismo envío puede funcionar más
+	// tarde. Si es false el error es definitivo: reenviar sin corregir dará el mismo resultado.
+	Reintentable bool
+}
+
+func (e *ErrorSUNAT) Error() string {
+	if e.Codigo == "" {
+		return fmt.Sprintf("SUNAT respondió con un error SOAP (%s): %s", e.FaultCode, e.Mensaje)
+	}
+	msg := fmt.Sprintf("SUNAT respondió con el error %s: %s", e.Codigo, e.Mensaje)
+	if e.FaultString != "" && e.FaultString != e.Codigo && e.FaultString != e.Mensaje {
+		msg += " (" + e.FaultString + ")"
+	}
+	return msg
+}
+
+// Autenticacion indica un problema con el usuario o la clave SOL (0101–0119).
+func (e *ErrorSUNAT) Autenticacion() bool {
+	return e.Codigo >= "0101" && e.Codigo <= "0119" && !e.Reintentable
+}
+
+// YaRegistrado indica que SUNAT ya tiene un comprobante con esa serie y número (1032, 1033).
+// En lugar de reenviar hay que consultar su CDR.
+func (e *ErrorSUNAT) YaRegistrado() bool {
+	return e.Codigo == "1032" || e.Codigo == "1033"
+}
+
+// codigosReintentables son las excepciones que SUNAT devuelve cuando el problema es suyo
+// ("El sistema no puede responder su solicitud"): servicio de autenticación caído, ticket,
+// almacenamiento, cola o base de datos.
+var codigosReintentables = map[string]bool{
+	"0100": true, "0109": true,
+	"0130": true, "0131": true, "0132": true, "0133": true, "0134": true, "0135": true, "0136": true, "0137": true, "0138": true,
+	"0200": true, "0201": true, "0202": true, "0203": true, "0250": true, "0251": true, "0252": true,
+}
+
+var (
+	regexCodigoRetorno       = regexp.MustCompile(`^\d{4}$`)
+	regexCodigoEnFaultString = regexp.MustCompile(`^\s*(\d{4})\b`)
+)
+
+// parsearFaultSOAP devuelve el ErrorSUNAT si la respuesta es un SOAP fault, o nil si no lo es.
+// El código viene en el faultcode ("soap-env:Client.1033") o, en algunos OSE, al inicio del
+// faultstring ("0102 - Usuario o contraseña incorrectos").
+func parsearFaultSOAP(respuesta []byte, estadoHTTP int) *ErrorSUNAT {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(respuesta); err != nil {
+		return nil
+	}
+	fault := doc.FindElement("//Fault")
+	if fault == nil {
+		return nil
+	}
+
+	e := &ErrorSUNAT{
+		FaultCode:   textoDe(fault, "faultcode"),
+		FaultString: textoDe(fault, "faultstring"),
+		EstadoHTTP:  estadoHTTP,
+	}
+	if i := strings.LastIndex(e.FaultCode, "."); i >= 0 && regexCodigoRetorno.MatchString(e.FaultCode[i+1:]) {
+		e.Codigo = e.FaultCode[i+1:]
+	} else if m := regexCodigoEnFaultString.FindStringSubmatch(e.FaultString); m != nil {
+		e.Codigo = m[1]
+	}
+
+	e.Mensaje = e.FaultString
+	if msg, ok := catalogos.MensajeRetorno(e.Codigo); ok {
+		e.Mensaje = msg
+	}
+	if e.Mensaje == "" {
+		e.Mensaje = "sin descripción"
+	}
+	e.Reintentable = codigosReintentables[e.Codigo] ||
+		(e.Codigo == "" && strings.Contains(strings.ToLower(e.FaultCode), "server"))
+	return e
+}
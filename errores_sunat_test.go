@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func faultPrueba(faultcode, faultstring string) []byte {
+	return []byte(fmt.Sprintf(`<soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap-env:Body>
+    <soap-env:Fault>
+      <faultcode>%s</faultcode>
+      <faultstring>%s</faultstring>
+    </soap-env:Fault>
+  </soap-env:Body>
+</soap-env:Envelope>`, faultcode, faultstring))
+}
+
+func TestParsearFaultSOAP(t *testing.T) {
+	casos := []struct {
+		nombre        string
+		respuesta     []byte
+		codigo        string
+		reintentable  bool
+		autenticacion bool
+		yaRegistrado  bool
+	}{
+		{nombre: "código en el faultcode", respuesta: faultPrueba("soap-env:Client.0102", "0102"), codigo: "0102", autenticacion: true},
+		{nombre: "código en el faultstring", respuesta: faultPrueba("soap-env:Client", "0104 - La Clave ingresada es incorrecta"), codigo: "0104", autenticacion: true},
+		{nombre: "servicio caído", respuesta: faultPrueba("soap-env:Server.0109", "0109"), codigo: "0109", reintentable: true},
+		{nombre: "base de datos", respuesta: faultPrueba("soap-env:Client.0138", "0138"), codigo: "0138", reintentable: true},
+		{nombre: "ya registrado", respuesta: faultPrueba("soap-env:Client.1033", "1033"), codigo: "1033", yaRegistrado: true},
+		{nombre: "rechazo de negocio", respuesta: faultPrueba("soap-env:Client.2800", "2800"), codigo: "2800"},
+		{nombre: "fault de servidor sin código", respuesta: faultPrueba("soap-env:Server", "Internal Error"), reintentable: true},
+		{nombre: "fault de cliente sin código", respuesta: faultPrueba("soap-env:Client", "Mensaje mal formado")},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			e := parsearFaultSOAP(c.respuesta, 500)
+			if e == nil {
+				t.Fatal("se esperaba un ErrorSUNAT")
+			}
+			if e.Codigo != c.codigo || e.Reintentable != c.reintentable || e.Autenticacion() != c.autenticacion || e.YaRegistrado() != c.yaRegistrado {
+				t.Errorf("se obtuvo código %q, reintentable %t, autenticación %t, ya registrado %t", e.Codigo, e.Reintentable, e.Autenticacion(), e.YaRegistrado())
+			}
+			if e.Mensaje == "" || e.EstadoHTTP != 500 {
+				t.Errorf("mensaje %q, estado %d", e.Mensaje, e.EstadoHTTP)
+			}
+		})
+	}
+}
+
+func TestParsearFaultSOAPSinFault(t *testing.T) {
+	respuestas := map[string][]byte{
+		"respuesta correcta": []byte(`<Envelope><Body><sendBillResponse><applicationResponse>UEsD</applicationResponse></sendBillResponse></Body></Envelope>`),
+		"no es XML":          []byte("<html>502 Bad Gateway"),
+	}
+	for nombre, r := range respuestas {
+		if e := parsearFaultSOAP(r, 200); e != nil {
+			t.Errorf("%s: se obtuvo %v, se esperaba nil", nombre, e)
+		}
+	}
+}
+
+func TestMensajeErrorSUNAT(t *testing.T) {
+	e := parsearFaultSOAP(faultPrueba("soap-env:Client.0102", "0102"), 500)
+	if got, want := e.Error(), "SUNAT respondió con el error 0102: Usuario o contraseña incorrectos"; got != want {
+		t.Errorf("Error() = %q, se esperaba %q", got, want)
+	}
+}
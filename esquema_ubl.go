@@ -0,0 +1,504 @@
+package main
+
+import (
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Los esquemas viven en esquemas/ como XSD: extractos de UBL 2.1 (maindoc, common y los
+// tipos de dato udt y ccts-cct) y de la extensión de SUNAT con los tipos que genera buildXML.
+// Para validar contra más tipos basta con agregar sus xsd:complexType y declaraciones; se
+// incrustan en el binario al compilar.
+//
+//go:embed esquemas
+var archivosEsquema embed.FS
+
+const nsXSD = "http://www.w3.org/2001/XMLSchema"
+
+// nombreXML es un nombre calificado por su espacio de nombres, como lo compara el XSD.
+type nombreXML struct {
+	ns, local string
+}
+
+// particula es un elemento dentro de la secuencia (xsd:sequence) de un tipo.
+type particula struct {
+	nombre   nombreXML
+	etiqueta string // el ref del XSD ("cbc:ID"), para los mensajes
+	min      int
+	max      int // -1 = unbounded
+	// cualquiera marca un xsd:any namespace="##other": admite un elemento de otro espacio
+	// de nombres que el del esquema (nombre.ns).
+	cualquiera bool
+	// proceso es el processContents del xsd:any: "strict", "lax" o "skip".
+	proceso string
+}
+
+func (p particula) admite(el *etree.Element) bool {
+	if p.cualquiera {
+		return el.NamespaceURI() != p.nombre.ns
+	}
+	return el.NamespaceURI() == p.nombre.ns && el.Tag == p.nombre.local
+}
+
+// atributoXSD es un xsd:attribute de un tipo de contenido simple.
+type atributoXSD struct {
+	tipo      nombreXML
+	requerido bool
+}
+
+// tipoXSD es un xsd:complexType: una secuencia de elementos (los agregados cac, sac, ext) o
+// un contenido simple (los cbc), que deriva de otro tipo por xsd:extension o xsd:restriction.
+type tipoXSD struct {
+	particulas []particula
+	simple     bool
+	base       nombreXML
+	atributos  map[string]atributoXSD
+	// valor es el tipo predefinido (xsd:decimal, xsd:date...) al final de la cadena de
+	// derivación; lo completa resolver.
+	valor nombreXML
+}
+
+// esquemaXSD reúne las declaraciones de todos los XSD incrustados.
+type esquemaXSD struct {
+	// elementos va de cada xsd:element global a su tipo.
+	elementos map[nombreXML]nombreXML
+	tipos     map[nombreXML]*tipoXSD
+}
+
+var esquemaUBL = cargarEsquemas()
+
+// cargarEsquemas lee los XSD incrustados. Un XSD mal formado, o que declara un elemento con
+// un tipo que no está incrustado, es un error de programación, por eso se detiene el
+// arranque en lugar de devolver un error.
+func cargarEsquemas() *esquemaXSD {
+	e := &esquemaXSD{elementos: map[nombreXML]nombreXML{}, tipos: map[nombreXML]*tipoXSD{}}
+	err := fs.WalkDir(archivosEsquema, "esquemas", func(ruta string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(ruta) != ".xsd" {
+			return err
+		}
+		data, err := archivosEsquema.ReadFile(ruta)
+		if err != nil {
+			return err
+		}
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(data); err != nil {
+			return fmt.Errorf("%s: %w", ruta, err)
+		}
+		if err := e.agregar(doc.Root()); err != nil {
+			return fmt.Errorf("%s: %w", ruta, err)
+		}
+		return nil
+	})
+	if err == nil {
+		err = e.resolver()
+	}
+	if err != nil {
+		panic(fmt.Sprintf("esquema XSD mal formado: %v", err))
+	}
+	return e
+}
+
+// agregar incorpora las declaraciones globales de un xsd:schema.
+func (e *esquemaXSD) agregar(schema *etree.Element) error {
+	tns := schema.SelectAttrValue("targetNamespace", "")
+	for _, decl := range schema.ChildElements() {
+		if decl.NamespaceURI() != nsXSD {
+			continue
+		}
+		nombre := nombreXML{tns, decl.SelectAttrValue("name", "")}
+		switch decl.Tag {
+		case "element":
+			tipo, err := resolverQName(decl, decl.SelectAttrValue("type", ""))
+			if err != nil {
+				return err
+			}
+			e.elementos[nombre] = tipo
+		case "complexType":
+			t, err := leerTipo(decl, tns)
+			if err != nil {
+				return fmt.Errorf("tipo %s: %w", nombre.local, err)
+			}
+			e.tipos[nombre] = t
+		}
+	}
+	return nil
+}
+
+func leerTipo(decl *etree.Element, tns string) (*tipoXSD, error) {
+	if secuencia := decl.SelectElement("xsd:sequence"); secuencia != nil {
+		t := &tipoXSD{}
+		for _, el := range secuencia.ChildElements() {
+			p, err := leerParticula(el, tns)
+			if err != nil {
+				return nil, err
+			}
+			t.particulas = append(t.particulas, p)
+		}
+		return t, nil
+	}
+	simple := decl.SelectElement("xsd:simpleContent")
+	if simple == nil {
+		return nil, fmt.Errorf("no tiene xsd:sequence ni xsd:simpleContent")
+	}
+	derivacion := simple.SelectElement("xsd:extension")
+	if derivacion == nil {
+		derivacion = simple.SelectElement("xsd:restriction")
+	}
+	if derivacion == nil {
+		return nil, fmt.Errorf("xsd:simpleContent sin xsd:extension ni xsd:restriction")
+	}
+	base, err := resolverQName(derivacion, derivacion.SelectAttrValue("base", ""))
+	if err != nil {
+		return nil, err
+	}
+	t := &tipoXSD{simple: true, base: base, atributos: map[string]atributoXSD{}}
+	for _, a := range derivacion.SelectElements("xsd:attribute") {
+		tipo, err := resolverQName(a, a.SelectAttrValue("type", ""))
+		if err != nil {
+			return nil, err
+		}
+		t.atributos[a.SelectAttrValue("name", "")] = atributoXSD{tipo: tipo, requerido: a.SelectAttrValue("use", "optional") == "required"}
+	}
+	return t, nil
+}
+
+// resolver recorre la cadena de derivación de cada tipo simple hasta el tipo predefinido,
+// hereda los atributos de la base (los del tipo derivado prevalecen) y comprueba que cada
+// elemento y cada base apunten a un tipo declarado.
+func (e *esquemaXSD) resolver() error {
+	for nombre, tipo := range e.elementos {
+		if _, ok := e.tipos[tipo]; !ok && !valorSoportado(tipo) {
+			return fmt.Errorf("el elemento %s declara el tipo %s, que no está en los esquemas incrustados", nombre.local, tipo.local)
+		}
+	}
+	var resolverTipo func(nombre nombreXML, visitados int) error
+	resolverTipo = func(nombre nombreXML, visitados int) error {
+		t := e.tipos[nombre]
+		if !t.simple || t.valor != (nombreXML{}) {
+			return nil
+		}
+		if visitados > len(e.tipos) {
+			return fmt.Errorf("el tipo %s deriva de sí mismo", nombre.local)
+		}
+		if valorSoportado(t.base) {
+			t.valor = t.base
+			return nil
+		}
+		base, ok := e.tipos[t.base]
+		if !ok || !base.simple {
+			return fmt.Errorf("el tipo %s deriva de %s, que no es un tipo simple incrustado", nombre.local, t.base.local)
+		}
+		if err := resolverTipo(t.base, visitados+1); err != nil {
+			return err
+		}
+		t.valor = base.valor
+		for n, a := range base.atributos {
+			if _, ok := t.atributos[n]; !ok {
+				t.atributos[n] = a
+			}
+		}
+		return nil
+	}
+	for nombre, t := range e.tipos {
+		if err := resolverTipo(nombre, 0); err != nil {
+			return err
+		}
+		for n, a := range t.atributos {
+			if !valorSoportado(a.tipo) {
+				return fmt.Errorf("el atributo %s de %s usa el tipo %s, que no se valida", n, nombre.local, a.tipo.local)
+			}
+		}
+	}
+	return nil
+}
+
+func leerParticula(el *etree.Element, tns string) (particula, error) {
+	p := particula{min: 1, max: 1}
+	if v := el.SelectAttrValue("minOccurs", "1"); v != "1" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("minOccurs %q inválido", v)
+		}
+		p.min = n
+	}
+	if v := el.SelectAttrValue("maxOccurs", "1"); v == "unbounded" {
+		p.max = -1
+	} else if v != "1" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("maxOccurs %q inválido", v)
+		}
+		p.max = n
+	}
+	switch el.Tag {
+	case "element":
+		ref := el.SelectAttrValue("ref", "")
+		nombre, err := resolverQName(el, ref)
+		if err != nil {
+			return p, err
+		}
+		p.nombre, p.etiqueta = nombre, ref
+	case "any":
+		if ns := el.SelectAttrValue("namespace", ""); ns != "##other" {
+			return p, fmt.Errorf("xsd:any namespace=%q no soportado", ns)
+		}
+		p.nombre, p.etiqueta, p.cualquiera = nombreXML{ns: tns}, "xsd:any ##other", true
+		p.proceso = el.SelectAttrValue("processContents", "strict")
+	default:
+		return p, fmt.Errorf("partícula xsd:%s no soportada", el.Tag)
+	}
+	return p, nil
+}
+
+// resolverQName traduce "prefijo:local" con los xmlns declarados en el XSD.
+func resolverQName(el *etree.Element, qname string) (nombreXML, error) {
+	prefijo, local, ok := strings.Cut(qname, ":")
+	if !ok {
+		prefijo, local = "", qname
+	}
+	atributo := "xmlns"
+	if prefijo != "" {
+		atributo = "xmlns:" + prefijo
+	}
+	for e := el; e != nil; e = e.Parent() {
+		if ns := e.SelectAttr(atributo); ns != nil {
+			return nombreXML{ns.Value, local}, nil
+		}
+	}
+	return nombreXML{}, fmt.Errorf("prefijo sin declarar en %q", qname)
+}
+
+// ErrorEsquema señala el primer elemento que rompe el modelo de contenido UBL 2.1.
+type ErrorEsquema struct {
+	Ruta    string
+	Mensaje string
+}
+
+func (e *ErrorEsquema) Error() string {
+	return fmt.Sprintf("%s: %s", e.Ruta, e.Mensaje)
+}
+
+// validarEsquema comprueba el orden, la cardinalidad y los nombres de los elementos
+// generados por buildXML contra los XSD de UBL 2.1 y de SUNAT, además del valor y los
+// atributos de cada cbc, para que un error de esquema falle localmente y no como el error
+// 0306 de SUNAT. Un elemento sin declaración en los XSD incrustados es un error, salvo en un
+// xsd:any lax o skip (ds:Signature dentro de ext:ExtensionContent).
+func validarEsquema(doc *etree.Document) error {
+	root := doc.Root()
+	if root == nil {
+		return &ErrorEsquema{Ruta: "/", Mensaje: "el documento no tiene elemento raíz"}
+	}
+	tipo, ok := esquemaUBL.elementos[nombreXML{root.NamespaceURI(), root.Tag}]
+	if !ok {
+		return &ErrorEsquema{Ruta: "/" + root.FullTag(), Mensaje: "tipo de documento UBL no soportado"}
+	}
+	return validarContenido(root, tipo, "/"+root.FullTag())
+}
+
+func validarContenido(el *etree.Element, nombreTipo nombreXML, ruta string) error {
+	tipo, ok := esquemaUBL.tipos[nombreTipo]
+	if !ok {
+		if valorSoportado(nombreTipo) {
+			return validarSimple(el, nombreTipo, nil, ruta)
+		}
+		return &ErrorEsquema{Ruta: ruta, Mensaje: fmt.Sprintf("el tipo %s no está en los esquemas incrustados", nombreTipo.local)}
+	}
+	if tipo.simple {
+		return validarSimple(el, tipo.valor, tipo.atributos, ruta)
+	}
+	if err := validarAtributos(el, nil, ruta); err != nil {
+		return err
+	}
+	if texto := strings.TrimSpace(textoPropio(el)); texto != "" {
+		return &ErrorEsquema{Ruta: ruta, Mensaje: fmt.Sprintf("el elemento no admite texto (se encontró %q)", texto)}
+	}
+
+	modelo := tipo.particulas
+	hijos := el.ChildElements()
+	admitidoPor := make([]particula, len(hijos))
+	i := 0
+	for _, p := range modelo {
+		n := 0
+		for i < len(hijos) && p.admite(hijos[i]) {
+			admitidoPor[i] = p
+			n++
+			i++
+		}
+		if n < p.min {
+			if i < len(hijos) {
+				if msg := mensajeFueraDeOrden(modelo, hijos, i); msg != "" {
+					return &ErrorEsquema{Ruta: ruta, Mensaje: msg}
+				}
+			}
+			return &ErrorEsquema{Ruta: ruta, Mensaje: fmt.Sprintf("falta el elemento obligatorio %s%s", p.etiqueta, encontradoEn(hijos, i))}
+		}
+		if p.max != -1 && n > p.max {
+			return &ErrorEsquema{Ruta: ruta, Mensaje: fmt.Sprintf("el elemento %s aparece %d veces y solo se permite %d", p.etiqueta, n, p.max)}
+		}
+	}
+	if i < len(hijos) {
+		msg := mensajeFueraDeOrden(modelo, hijos, i)
+		if msg == "" {
+			msg = fmt.Sprintf("el elemento %s está fuera de orden o repetido", hijos[i].FullTag())
+		}
+		return &ErrorEsquema{Ruta: ruta, Mensaje: msg}
+	}
+
+	for j, h := range hijos {
+		p := admitidoPor[j]
+		if p.cualquiera && p.proceso == "skip" {
+			continue
+		}
+		subtipo, ok := esquemaUBL.elementos[nombreXML{h.NamespaceURI(), h.Tag}]
+		if !ok {
+			if p.cualquiera && p.proceso == "lax" {
+				continue
+			}
+			return &ErrorEsquema{Ruta: ruta + "/" + h.FullTag(), Mensaje: "el elemento no está declarado en los esquemas incrustados"}
+		}
+		if err := validarContenido(h, subtipo, ruta+"/"+h.FullTag()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validarSimple revisa un elemento de contenido simple: sin hijos, con un valor del tipo
+// predefinido y con los atributos que declara su tipo.
+func validarSimple(el *etree.Element, valor nombreXML, atributos map[string]atributoXSD, ruta string) error {
+	if hijos := el.ChildElements(); len(hijos) > 0 {
+		return &ErrorEsquema{Ruta: ruta, Mensaje: fmt.Sprintf("el elemento no admite elementos hijos (se encontró %s)", hijos[0].FullTag())}
+	}
+	if err := validarAtributos(el, atributos, ruta); err != nil {
+		return err
+	}
+	return validarValor(valor, el.Text(), ruta)
+}
+
+func validarAtributos(el *etree.Element, atributos map[string]atributoXSD, ruta string) error {
+	presentes := map[string]bool{}
+	for _, a := range el.Attr {
+		if a.Space == "xmlns" || (a.Space == "" && a.Key == "xmlns") {
+			continue
+		}
+		decl, ok := atributos[a.Key]
+		if !ok || a.Space != "" {
+			return &ErrorEsquema{Ruta: ruta + "/@" + a.FullKey(), Mensaje: "el atributo no está permitido en este elemento"}
+		}
+		if err := validarValor(decl.tipo, a.Value, ruta+"/@"+a.Key); err != nil {
+			return err
+		}
+		presentes[a.Key] = true
+	}
+	for nombre, decl := range atributos {
+		if decl.requerido && !presentes[nombre] {
+			return &ErrorEsquema{Ruta: ruta, Mensaje: fmt.Sprintf("falta el atributo obligatorio %s", nombre)}
+		}
+	}
+	return nil
+}
+
+// textoPropio junta el texto directo del elemento, sin el de sus hijos.
+func textoPropio(el *etree.Element) string {
+	var b strings.Builder
+	for _, t := range el.Child {
+		if cd, ok := t.(*etree.CharData); ok {
+			b.WriteString(cd.Data)
+		}
+	}
+	return b.String()
+}
+
+var (
+	regexDecimalXSD  = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+	regexFechaXSD    = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})(Z|[+-]\d{2}:\d{2})?$`)
+	regexHoraXSD     = regexp.MustCompile(`^(\d{2}:\d{2}:\d{2})(\.\d+)?(Z|[+-]\d{2}:\d{2})?$`)
+	regexIdiomaXSD   = regexp.MustCompile(`^[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*$`)
+	validadoresValor = map[string]func(string) bool{
+		"string":           func(string) bool { return true },
+		"anyURI":           func(string) bool { return true },
+		"normalizedString": func(v string) bool { return !strings.ContainsAny(v, "\r\n\t") },
+		"decimal":          func(v string) bool { return regexDecimalXSD.MatchString(strings.TrimSpace(v)) },
+		"boolean": func(v string) bool {
+			switch strings.TrimSpace(v) {
+			case "true", "false", "1", "0":
+				return true
+			}
+			return false
+		},
+		"date": func(v string) bool {
+			m := regexFechaXSD.FindStringSubmatch(strings.TrimSpace(v))
+			if m == nil {
+				return false
+			}
+			_, err := time.Parse("2006-01-02", m[1])
+			return err == nil
+		},
+		"time": func(v string) bool {
+			m := regexHoraXSD.FindStringSubmatch(strings.TrimSpace(v))
+			if m == nil {
+				return false
+			}
+			_, err := time.Parse("15:04:05", m[1])
+			return err == nil
+		},
+		"base64Binary": func(v string) bool {
+			_, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(v), ""))
+			return err == nil
+		},
+		"language": func(v string) bool { return regexIdiomaXSD.MatchString(strings.TrimSpace(v)) },
+	}
+)
+
+// valorSoportado indica si el tipo es uno de los predefinidos de XSD que se saben validar.
+func valorSoportado(tipo nombreXML) bool {
+	_, ok := validadoresValor[tipo.local]
+	return ok && tipo.ns == nsXSD
+}
+
+func validarValor(tipo nombreXML, valor, ruta string) error {
+	if !validadoresValor[tipo.local](valor) {
+		return &ErrorEsquema{Ruta: ruta, Mensaje: fmt.Sprintf("el valor %q no es un xsd:%s válido", valor, tipo.local)}
+	}
+	return nil
+}
+
+// mensajeFueraDeOrden explica si el hijo no existe en el tipo o si está ubicado después de
+// un elemento que el XSD exige que vaya detrás de él. Devuelve "" si no hay tal conflicto.
+func mensajeFueraDeOrden(modelo []particula, hijos []*etree.Element, i int) string {
+	posicion := -1
+	for j, p := range modelo {
+		if p.admite(hijos[i]) {
+			posicion = j
+			break
+		}
+	}
+	tag := hijos[i].FullTag()
+	if posicion == -1 {
+		return fmt.Sprintf("el elemento %s no está permitido aquí", tag)
+	}
+	for j := i - 1; j >= 0; j-- {
+		for k := posicion + 1; k < len(modelo); k++ {
+			if modelo[k].admite(hijos[j]) {
+				return fmt.Sprintf("el elemento %s debe ir antes de %s según UBL 2.1", tag, hijos[j].FullTag())
+			}
+		}
+	}
+	return ""
+}
+
+func encontradoEn(hijos []*etree.Element, i int) string {
+	if i >= len(hijos) {
+		return ""
+	}
+	return fmt.Sprintf(" (se encontró %s)", hijos[i].FullTag())
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func TestValidarEsquema(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		modificar func(doc *etree.Document)
+		mensaje   string // "" si el XML debe cumplir el esquema
+	}{
+		{nombre: "XML de buildXML", modificar: func(doc *etree.Document) {}},
+		{nombre: "agregado fuera de orden", modificar: func(doc *etree.Document) {
+			party := doc.FindElement("//cac:AccountingSupplierParty/cac:Party")
+			nombre := party.SelectElement("cac:PartyName")
+			party.RemoveChild(nombre)
+			party.InsertChildAt(0, nombre)
+		}, mensaje: "cac:PartyIdentification debe ir antes de cac:PartyName"},
+		{nombre: "elemento ajeno al tipo", modificar: func(doc *etree.Document) {
+			doc.FindElement("//cac:LegalMonetaryTotal").CreateElement("cbc:Foo")
+		}, mensaje: "cbc:Foo no está permitido"},
+		{nombre: "elemento sin declaración incrustada", modificar: func(doc *etree.Document) {
+			firma := doc.FindElement("/Invoice/cac:Signature")
+			doc.Root().InsertChildAt(firma.Index(), etree.NewElement("cac:OrderReference"))
+		}, mensaje: "no está declarado en los esquemas incrustados"},
+		{nombre: "monto sin moneda", modificar: func(doc *etree.Document) {
+			doc.FindElement("//cac:LegalMonetaryTotal/cbc:PayableAmount").RemoveAttr("currencyID")
+		}, mensaje: "falta el atributo obligatorio currencyID"},
+		{nombre: "monto no numérico", modificar: func(doc *etree.Document) {
+			doc.FindElement("//cac:LegalMonetaryTotal/cbc:PayableAmount").SetText("12,50")
+		}, mensaje: `"12,50" no es un xsd:decimal`},
+		{nombre: "fecha inválida", modificar: func(doc *etree.Document) {
+			doc.FindElement("/Invoice/cbc:IssueDate").SetText("2025-02-30")
+		}, mensaje: "no es un xsd:date"},
+		{nombre: "atributo no declarado", modificar: func(doc *etree.Document) {
+			doc.FindElement("/Invoice/cbc:ID").CreateAttr("currencyID", "PEN")
+		}, mensaje: "el atributo no está permitido"},
+		{nombre: "texto en un agregado", modificar: func(doc *etree.Document) {
+			doc.FindElement("//cac:LegalMonetaryTotal").CreateText("100.00")
+		}, mensaje: "no admite texto"},
+		{nombre: "hijo en un elemento básico", modificar: func(doc *etree.Document) {
+			doc.FindElement("/Invoice/cbc:ID").CreateElement("cbc:Name")
+		}, mensaje: "no admite elementos hijos"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			doc := buildXML(facturaPrueba(t))
+			c.modificar(doc)
+			err := validarEsquema(doc)
+			if c.mensaje == "" {
+				if err != nil {
+					t.Fatalf("se esperaba un XML válido y se obtuvo %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.mensaje) {
+				t.Errorf("se obtuvo %v, se esperaba un error con %q", err, c.mensaje)
+			}
+		})
+	}
+}
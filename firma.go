@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ConfigFirma indica con qué certificado se firman los comprobantes.
+type ConfigFirma struct {
+	// Certificado es un .pfx/.p12 con la clave y la cadena, o un PEM con el certificado
+	// seguido de sus intermedios.
+	Certificado string `json:"certificado"`
+	// ClavePrivada es el PEM de la clave (PKCS#8, PKCS#1 o EC) cuando Certificado es PEM.
+	ClavePrivada string `json:"clavePrivada,omitempty"`
+	// ClavePFX protege el .pfx; también puede venir de SUNAT_CLAVE_PFX o de un archivo de
+	// secreto (SUNAT_CLAVE_PFX_ARCHIVO o "clavePfxArchivo").
+	ClavePFX        secreto `json:"clavePfx,omitempty"`
+	ClavePFXArchivo string  `json:"clavePfxArchivo,omitempty"`
+	// RevisionMs es cada cuánto se revisa si cambiaron los archivos para recargarlos (30 s
+	// por defecto). Con SIGHUP se recargan en el momento.
+	RevisionMs int `json:"revisionMs,omitempty"`
+}
+
+// firmaPorDefecto es el certificado de demostración que viene en ./certs.
+var firmaPorDefecto = ConfigFirma{Certificado: "./certs/public.pem", ClavePrivada: "./certs/private_pkcs8.key"}
+
+// resolverFirma completa la configuración de firma: usa el certificado de demostración si
+// no se indicó ninguno y toma la clave del .pfx de su fuente, registrándola como secreto.
+// El certificado de un emisor lee SUNAT_CLAVE_PFX_<RUC> (sufijo "_<RUC>"); el común,
+// SUNAT_CLAVE_PFX.
+func resolverFirma(cfg ConfigFirma, sufijo string) (ConfigFirma, error) {
+	if cfg.Certificado == "" {
+		defecto := firmaPorDefecto
+		defecto.RevisionMs = cfg.RevisionMs
+		return defecto, nil
+	}
+	clave, err := leerSecreto("SUNAT_CLAVE_PFX"+sufijo, "SUNAT_CLAVE_PFX_ARCHIVO"+sufijo, cfg.ClavePFXArchivo, cfg.ClavePFX)
+	if err != nil {
+		return ConfigFirma{}, fmt.Errorf("no se pudo leer el secreto de la clave del certificado: %w", err)
+	}
+	registrarSecreto(clave)
+	cfg.ClavePFX = secreto(clave)
+	return cfg, nil
+}
+
+// credencialFirma es la clave privada y la cadena de certificados con que se firma. La
+// cadena empieza por el certificado del firmante; los intermedios van en X509Data.
+type credencialFirma struct {
+	clave  crypto.Signer
+	cadena []*x509.Certificate
+}
+
+// cargarCredencialFirma lee el certificado y la clave indicados en cfg.
+func cargarCredencialFirma(cfg ConfigFirma) (*credencialFirma, error) {
+	data, err := os.ReadFile(cfg.Certificado)
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *credencialFirma
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		cred, err = leerCredencialPEM(cfg, data)
+	} else {
+		cred, err = leerPFX(data, string(cfg.ClavePFX))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Certificado, err)
+	}
+
+	publica, ok := cred.clave.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publica.Equal(cred.cadena[0].PublicKey) {
+		return nil, fmt.Errorf("la clave privada no corresponde al certificado %s", cfg.Certificado)
+	}
+	return cred, nil
+}
+
+// leerPFX abre un PKCS#12 protegido con clave y separa la clave, el certificado del
+// firmante y los intermedios. Las raíces autofirmadas no se incluyen en la cadena.
+func leerPFX(data []byte, clave string) (*credencialFirma, error) {
+	privada, cert, cas, err := pkcs12.DecodeChain(data, clave)
+	if err != nil {
+		if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+			return nil, errors.New("la clave del .pfx es incorrecta")
+		}
+		return nil, fmt.Errorf("no es un PKCS#12 válido: %w", err)
+	}
+	signer, err := adaptarClave(privada)
+	if err != nil {
+		return nil, err
+	}
+	cadena := []*x509.Certificate{cert}
+	for _, ca := range cas {
+		if bytes.Equal(ca.RawSubject, ca.RawIssuer) {
+			continue
+		}
+		cadena = append(cadena, ca)
+	}
+	return &credencialFirma{clave: signer, cadena: cadena}, nil
+}
+
+func leerCredencialPEM(cfg ConfigFirma, certData []byte) (*credencialFirma, error) {
+	cadena, err := cargarCertificados([]string{cfg.Certificado})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ClavePrivada == "" {
+		return nil, errors.New("un certificado PEM necesita clavePrivada")
+	}
+	keyData, err := os.ReadFile(cfg.ClavePrivada)
+	if err != nil {
+		return nil, err
+	}
+	clave, err := leerClavePEM(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.ClavePrivada, err)
+	}
+	return &credencialFirma{clave: clave, cadena: cadena}, nil
+}
+
+// leerClavePEM acepta claves PKCS#8 ("PRIVATE KEY"), PKCS#1 ("RSA PRIVATE KEY") y EC
+// ("EC PRIVATE KEY"). Las claves cifradas no: Go no descifra PKCS#8 cifrado.
+func leerClavePEM(data []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no contiene una clave privada PEM")
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			return adaptarClave(key)
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			return adaptarClave(key)
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, errors.New("la clave está cifrada; use el .pfx directamente o descífrela con openssl pkey")
+		}
+	}
+}
+
+// adaptarClave convierte la clave leída en el crypto.Signer que espera goxmldsig.
+func adaptarClave(key any) (crypto.Signer, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return firmanteEC{k}, nil
+	}
+	return nil, fmt.Errorf("tipo de clave no soportado %T: se espera RSA o EC", key)
+}
+
+// firmanteEC adapta una clave ECDSA a XMLDSig, que espera la firma como r||s de largo fijo
+// y no en el DER que devuelve crypto/ecdsa.
+type firmanteEC struct {
+	*ecdsa.PrivateKey
+}
+
+func (f firmanteEC) Sign(rand io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand, f.PrivateKey, digest)
+	if err != nil {
+		return nil, err
+	}
+	n := (f.Curve.Params().BitSize + 7) / 8
+	firma := make([]byte, 2*n)
+	r.FillBytes(firma[:n])
+	s.FillBytes(firma[n:])
+	return firma, nil
+}
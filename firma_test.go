@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestLeerClavePEM(t *testing.T) {
+	claveRSA, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claveEC, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8RSA, _ := x509.MarshalPKCS8PrivateKey(claveRSA)
+	pkcs8EC, _ := x509.MarshalPKCS8PrivateKey(claveEC)
+	sec1EC, _ := x509.MarshalECPrivateKey(claveEC)
+	codificar := func(bloques ...*pem.Block) []byte {
+		var data []byte
+		for _, b := range bloques {
+			data = append(data, pem.EncodeToMemory(b)...)
+		}
+		return data
+	}
+	certificado := &pem.Block{Type: "CERTIFICATE", Bytes: []byte("no se lee")}
+
+	casos := []struct {
+		nombre string
+		data   []byte
+		tipo   string // "" si debe fallar
+	}{
+		{"PKCS#8 RSA", codificar(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8RSA}), "rsa"},
+		{"PKCS#1 RSA", codificar(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(claveRSA)}), "rsa"},
+		{"PKCS#8 EC", codificar(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8EC}), "ec"},
+		{"SEC 1 EC", codificar(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1EC}), "ec"},
+		{"clave después del certificado", codificar(certificado, &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8RSA}), "rsa"},
+		{"PKCS#8 cifrada", codificar(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte{0x30}}), ""},
+		{"PKCS#8 corrupta", codificar(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("basura")}), ""},
+		{"solo certificado", codificar(certificado), ""},
+		{"sin PEM", []byte("basura"), ""},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			clave, err := leerClavePEM(c.data)
+			if c.tipo == "" {
+				if err == nil {
+					t.Fatalf("se esperaba un error y se leyó una clave %T", clave)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch k := clave.(type) {
+			case *rsa.PrivateKey:
+				if c.tipo != "rsa" || !k.Equal(claveRSA) {
+					t.Errorf("se leyó otra clave RSA")
+				}
+			case firmanteEC:
+				if c.tipo != "ec" || !k.PrivateKey.Equal(claveEC) {
+					t.Errorf("se leyó otra clave EC")
+				}
+			default:
+				t.Errorf("tipo de clave inesperado %T", clave)
+			}
+		})
+	}
+}
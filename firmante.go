@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// revisionPorDefecto es cada cuánto se mira si cambiaron los archivos del certificado.
+const revisionPorDefecto = 30 * time.Second
+
+// Firmante guarda el certificado y el contexto de firma ya armados, compartidos por todas
+// las peticiones. Se recarga sin reiniciar el servidor cuando cambian los archivos o al
+// recibir SIGHUP, para renovar un certificado por vencer. Si la recarga falla se sigue
+// firmando con el certificado anterior.
+type Firmante struct {
+	cfg ConfigFirma
+	// sufijo distingue las variables de la clave del .pfx de un emisor (_<RUC>) de las del
+	// certificado común ("").
+	sufijo string
+
+	mu     sync.RWMutex
+	actual *firmaCargada
+	// vistas son las huellas de los archivos en el último intento de carga, haya salido
+	// bien o no, para no reintentar en cada revisión un archivo que sigue roto.
+	vistas map[string]huellaArchivo
+}
+
+// firmaCargada es una versión del certificado lista para firmar.
+type firmaCargada struct {
+	cred     *credencialFirma
+	contexto *dsig.SigningContext
+}
+
+// huellaArchivo identifica una versión de un archivo sin leerlo.
+type huellaArchivo struct {
+	modificado time.Time
+	tamano     int64
+}
+
+// nuevoFirmante carga el certificado indicado en cfg. Un error aquí es fatal: no tiene
+// sentido arrancar sin poder firmar.
+func nuevoFirmante(cfg ConfigFirma, sufijo string) (*Firmante, error) {
+	f := &Firmante{cfg: cfg, sufijo: sufijo}
+	if err := f.Recargar(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Recargar vuelve a leer el certificado y la clave. Las peticiones en curso terminan con
+// la versión anterior; las siguientes usan la nueva.
+func (f *Firmante) Recargar() error {
+	vistas := f.huellas()
+	cargada, err := cargarFirma(f.cfg, f.sufijo)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.vistas = vistas
+	if err != nil {
+		return err
+	}
+	f.actual = cargada
+	return nil
+}
+
+// vigente devuelve la versión cargada del certificado. Su contexto de firma no se modifica
+// al firmar, así que puede usarse desde varias peticiones a la vez.
+func (f *Firmante) vigente() *firmaCargada {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.actual
+}
+
+// Certificado devuelve el certificado del firmante vigente.
+func (f *Firmante) Certificado() *x509.Certificate {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.actual.cred.cadena[0]
+}
+
+// vigilar recarga el certificado cuando cambian sus archivos (revisados cada intervalo)
+// o cuando llega una señal por hup. Termina al cancelarse ctx.
+func (f *Firmante) vigilar(ctx context.Context, hup <-chan os.Signal) {
+	intervalo := revisionPorDefecto
+	if f.cfg.RevisionMs > 0 {
+		intervalo = time.Duration(f.cfg.RevisionMs) * time.Millisecond
+	}
+	ticker := time.NewTicker(intervalo)
+	defer ticker.Stop()
+	for {
+		var motivo string
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			motivo = "SIGHUP"
+		case <-ticker.C:
+			if !f.cambiaron() {
+				continue
+			}
+			motivo = "cambiaron los archivos"
+		}
+		if err := f.Recargar(); err != nil {
+			log.Printf("No se pudo recargar el certificado de firma %s (%s), se sigue usando el anterior: %v", f.archivos()[0], motivo, err)
+			continue
+		}
+		cert := f.Certificado()
+		log.Printf("Certificado de firma %s recargado (%s): %q, vence %s", f.archivos()[0], motivo, cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+	}
+}
+
+// archivos son los archivos de los que depende el certificado cargado.
+func (f *Firmante) archivos() []string {
+	cfg := f.cfg
+	if cfg.Certificado == "" {
+		cfg = firmaPorDefecto
+	}
+	var rutas []string
+	for _, r := range []string{cfg.Certificado, cfg.ClavePrivada, primeroNoVacio(os.Getenv("SUNAT_CLAVE_PFX_ARCHIVO"+f.sufijo), cfg.ClavePFXArchivo)} {
+		if r != "" {
+			rutas = append(rutas, r)
+		}
+	}
+	return rutas
+}
+
+func (f *Firmante) huellas() map[string]huellaArchivo {
+	huellas := map[string]huellaArchivo{}
+	for _, ruta := range f.archivos() {
+		if info, err := os.Stat(ruta); err == nil {
+			huellas[ruta] = huellaArchivo{modificado: info.ModTime(), tamano: info.Size()}
+		}
+	}
+	return huellas
+}
+
+func (f *Firmante) cambiaron() bool {
+	actuales := f.huellas()
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(actuales) != len(f.vistas) {
+		return true
+	}
+	for ruta, h := range actuales {
+		if f.vistas[ruta] != h {
+			return true
+		}
+	}
+	return false
+}
+
+// cargarFirma lee el certificado y arma el contexto de firma que usa firmarXML.
+func cargarFirma(cfg ConfigFirma, sufijo string) (*firmaCargada, error) {
+	cfg, err := resolverFirma(cfg, sufijo)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := cargarCredencialFirma(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// X509Data lleva el certificado del firmante y sus intermedios.
+	certChain := make([][]byte, 0, len(cred.cadena))
+	for _, cert := range cred.cadena {
+		certChain = append(certChain, cert.Raw)
+	}
+	ctx, err := dsig.NewSigningContext(cred.clave, certChain)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo preparar la firma: %w", err)
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10RecCanonicalizer()
+	ctx.Hash = crypto.SHA1
+	return &firmaCargada{cred: cred, contexto: ctx}, nil
+}
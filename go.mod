@@ -8,7 +8,10 @@ require (
 	github.com/russellhaering/goxmldsig v1.5.0
 	github.com/shopspring/decimal v1.4.0
 	golang.org/x/text v0.26.0
-
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
-require github.com/jonboulle/clockwork v0.5.0 // indirect
+require (
+	github.com/jonboulle/clockwork v0.5.0 // indirect
+	golang.org/x/crypto v0.11.0 // indirect
+)
@@ -1,20 +1,29 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+
+	"mi-conversor-ubl/catalogos"
 )
 
-// La función ahora devuelve un http.HandlerFunc para poder "inyectar" el cliente.
-func convertirHandler(sunatClient *Client) http.HandlerFunc {
+// La función ahora devuelve un http.HandlerFunc para poder "inyectar" los clientes,
+// uno por RUC emisor configurado.
+func convertirHandler(clientes map[string]*Client, firmas *AlmacenFirmas) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		correlationID := uuid.New().String()
+		ctx := conCorrelacion(r.Context(), correlationID)
 		log.Printf("[%s] Petición de conversión y envío recibida", correlationID)
 
 		if r.Method != http.MethodPost {
@@ -29,7 +38,31 @@ func convertirHandler(sunatClient *Client) http.HandlerFunc {
 			return
 		}
 
-		xmlFirmado, err := ProcesarDocumento(&docIn)
+		sunatClient, ok := clientes[docIn.Emisor.RUC]
+		if !ok {
+			log.Printf("[%s] El emisor %s no está configurado", correlationID, docIn.Emisor.RUC)
+			responderError(w, correlationID, "ERR_EMISOR_NO_CONFIGURADO", fmt.Sprintf("El emisor %s no está configurado para enviar comprobantes.", docIn.Emisor.RUC), http.StatusUnprocessableEntity)
+			return
+		}
+
+		completarDirecciones(&docIn)
+		validacion := ValidarDocumento(&docIn, time.Now(), sunatClient.Entorno.Nombre)
+		if errs := validacion.Errores(); len(errs) > 0 {
+			log.Printf("[%s] El documento incumple %d reglas de validación de SUNAT", correlationID, len(errs))
+			respuesta := RespuestaError{Status: "error", CorrelationId: correlationID, ErrorCode: "ERR_VALIDACION", ErrorMessage: "El documento no cumple las reglas de validación de SUNAT.", Errores: errs}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(respuesta)
+			return
+		}
+
+		xmlFirmado, err := ProcesarDocumento(&docIn, firmas)
+		var errFirma *ErrorFirma
+		if errors.As(err, &errFirma) {
+			log.Printf("[%s] %v", correlationID, err)
+			responderError(w, correlationID, "ERR_CERTIFICADO_FIRMA", err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
 		if err != nil {
 			log.Printf("[%s] Error procesando documento: %v", correlationID, err)
 			responderError(w, correlationID, "ERR_PROCESAMIENTO", err.Error(), http.StatusInternalServerError)
@@ -50,31 +83,470 @@ func convertirHandler(sunatClient *Client) http.HandlerFunc {
 		log.Printf("[%s] Intentando enviar documento a SUNAT...", correlationID)
 
 		// Usamos el método del cliente que inyectamos.
-		cdr, err := sunatClient.EnviarFactura(nombreArchivoZIP, nombreArchivoXML, xmlFirmado)
+		cdr, err := sunatClient.EnviarFactura(ctx, nombreArchivoZIP, nombreArchivoXML, xmlFirmado)
 		if err != nil {
 			log.Printf("[%s] Error en el envío a SUNAT: %v", correlationID, err)
-			responderError(w, correlationID, "ERR_ENVIO_SUNAT", err.Error(), http.StatusBadGateway)
+			responderErrorEnvio(w, correlationID, err)
 			return
 		}
 
-		log.Printf("[%s] Documento enviado exitosamente a SUNAT. CDR recibido.", correlationID)
+		log.Printf("[%s] Documento enviado a SUNAT. CDR recibido: %s (%s) %s", correlationID, cdr.Estado, cdr.CodigoRespuesta, cdr.Descripcion)
 
 		// Guardar el CDR
 		rutaCDR := fmt.Sprintf("./storage/R-%s.xml", nombreBase)
-		if err := os.WriteFile(rutaCDR, []byte(cdr), 0644); err != nil {
+		if err := os.WriteFile(rutaCDR, cdr.XML, 0644); err != nil {
 			log.Printf("[%s] Error guardando archivo CDR: %v", correlationID, err)
 		}
 
-		respuesta := RespuestaExito{Status: "success", CorrelationId: correlationID, DocumentId: fmt.Sprintf("%s-%s", docIn.Serie, docIn.Correlativo), XmlPath: rutaArchivo, XmlHash: "sha256:" + calcularHash(xmlFirmado), ProcessedAt: time.Now().UTC().Format(time.RFC3339), SunatCDR: cdr}
+		if !cdr.Aceptado() {
+			// El envío funcionó pero el comprobante no es válido: no se informa como éxito.
+			responderJSON(w, http.StatusUnprocessableEntity, RespuestaError{
+				Status:        "error",
+				CorrelationId: correlationID,
+				ErrorCode:     "ERR_SUNAT_RECHAZO_CDR",
+				ErrorMessage:  fmt.Sprintf("SUNAT rechazó el comprobante en el CDR (%s): %s", cdr.CodigoRespuesta, cdr.Descripcion),
+				CodigoSunat:   cdr.CodigoRespuesta,
+				CDR:           cdr,
+			})
+			return
+		}
+
+		respuesta := RespuestaExito{Status: "success", CorrelationId: correlationID, DocumentId: fmt.Sprintf("%s-%s", docIn.Serie, docIn.Correlativo), XmlPath: rutaArchivo, XmlHash: "sha256:" + calcularHash(xmlFirmado), ProcessedAt: time.Now().UTC().Format(time.RFC3339), SunatCDR: string(cdr.XML), CDR: cdr, Observaciones: validacion.Observaciones()}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(respuesta)
 	}
 }
 
-// responderError no cambia
+// comprobanteDeRuta valida {ruc}/{tipo}/{serie}/{numero} de la ruta y devuelve el cliente
+// del emisor. Si algo no cuadra ya respondió el error.
+func comprobanteDeRuta(w http.ResponseWriter, r *http.Request, clientes map[string]*Client, corrID string) (*Client, string, bool) {
+	ruc, tipo, serie, numero := r.PathValue("ruc"), r.PathValue("tipo"), r.PathValue("serie"), r.PathValue("numero")
+	patron, tipoValido := regexSerie[tipo]
+	if !tipoValido || !patron.MatchString(serie) || !regexCorrelativo.MatchString(numero) {
+		responderError(w, corrID, "ERR_COMPROBANTE_INVALIDO", fmt.Sprintf("%s-%s-%s no es un tipo, serie y número de comprobante válidos.", tipo, serie, numero), http.StatusBadRequest)
+		return nil, "", false
+	}
+	cliente, ok := clientes[ruc]
+	if !ok {
+		responderError(w, corrID, "ERR_EMISOR_NO_CONFIGURADO", fmt.Sprintf("El emisor %s no está configurado para enviar comprobantes.", ruc), http.StatusUnprocessableEntity)
+		return nil, "", false
+	}
+	return cliente, fmt.Sprintf("%s-%s-%s-%s", ruc, tipo, serie, numero), true
+}
+
+// estadoComprobanteHandler responde GET /comprobantes/{ruc}/{tipo}/{serie}/{numero}/estado
+// con el estado que SUNAT tiene registrado para el comprobante (getStatus).
+func estadoComprobanteHandler(clientes map[string]*Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		correlationID := uuid.New().String()
+		ctx := conCorrelacion(r.Context(), correlationID)
+		cliente, nombreBase, ok := comprobanteDeRuta(w, r, clientes, correlationID)
+		if !ok {
+			return
+		}
+		consulta, err := cliente.ConsultarEstado(ctx, r.PathValue("ruc"), r.PathValue("tipo"), r.PathValue("serie"), r.PathValue("numero"))
+		if err != nil {
+			log.Printf("[%s] Error consultando el estado de %s: %v", correlationID, nombreBase, err)
+			responderErrorEnvio(w, correlationID, err)
+			return
+		}
+		responderJSON(w, http.StatusOK, RespuestaConsulta{Status: "success", CorrelationId: correlationID, DocumentId: nombreBase, Consulta: consulta})
+	}
+}
+
+// recuperarCDRHandler responde POST /comprobantes/{ruc}/{tipo}/{serie}/{numero}/cdr: pide a
+// SUNAT el CDR del comprobante (getStatusCdr) y lo vuelve a guardar en ./storage, para cuando
+// el envío venció de nuestro lado o se perdió el archivo R-*.xml. No reenvía el comprobante.
+func recuperarCDRHandler(clientes map[string]*Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		correlationID := uuid.New().String()
+		ctx := conCorrelacion(r.Context(), correlationID)
+		cliente, nombreBase, ok := comprobanteDeRuta(w, r, clientes, correlationID)
+		if !ok {
+			return
+		}
+		log.Printf("[%s] Recuperando el CDR de %s", correlationID, nombreBase)
+		consulta, err := cliente.ConsultarCDR(ctx, r.PathValue("ruc"), r.PathValue("tipo"), r.PathValue("serie"), r.PathValue("numero"))
+		if err != nil {
+			log.Printf("[%s] Error consultando el CDR de %s: %v", correlationID, nombreBase, err)
+			responderErrorEnvio(w, correlationID, err)
+			return
+		}
+		if consulta.CDR == nil {
+			responderError(w, correlationID, "ERR_CDR_NO_DISPONIBLE", fmt.Sprintf("SUNAT no devolvió el CDR de %s (%s): %s", nombreBase, consulta.Codigo, consulta.Mensaje), http.StatusNotFound)
+			return
+		}
+		// Si el XML enviado sigue en storage, el CDR debe corresponder también a su contenido.
+		xmlEnviado, _ := os.ReadFile(fmt.Sprintf("./storage/%s.xml", nombreBase))
+		documento := r.PathValue("serie") + "-" + r.PathValue("numero")
+		if err := cliente.verificarCDR(consulta.CDR, documento, xmlEnviado); err != nil {
+			log.Printf("[%s] %v", correlationID, err)
+			responderErrorEnvio(w, correlationID, err)
+			return
+		}
+
+		rutaCDR := fmt.Sprintf("./storage/R-%s.xml", nombreBase)
+		if err := os.WriteFile(rutaCDR, consulta.CDR.XML, 0644); err != nil {
+			log.Printf("[%s] Error guardando archivo CDR: %v", correlationID, err)
+			responderError(w, correlationID, "ERR_ALMACENAMIENTO", "No se pudo guardar el CDR recuperado.", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[%s] CDR de %s recuperado y guardado en %s", correlationID, nombreBase, rutaCDR)
+		responderJSON(w, http.StatusOK, RespuestaConsulta{Status: "success", CorrelationId: correlationID, DocumentId: nombreBase, CdrPath: rutaCDR, Consulta: consulta})
+	}
+}
+
+// intercambiosHandler responde GET /comprobantes/{ruc}/{tipo}/{serie}/{numero}/intercambios
+// con todas las llamadas SOAP hechas a SUNAT por el comprobante: envíos, reintentos y
+// consultas, con el sobre enviado y la respuesta tal como llegó.
+func intercambiosHandler(clientes map[string]*Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		correlationID := uuid.New().String()
+		cliente, nombreBase, ok := comprobanteDeRuta(w, r, clientes, correlationID)
+		if !ok {
+			return
+		}
+		intercambios, err := cliente.intercambios.leer(nombreBase)
+		if err != nil {
+			log.Printf("[%s] Error leyendo los intercambios de %s: %v", correlationID, nombreBase, err)
+			responderError(w, correlationID, "ERR_ALMACENAMIENTO", "No se pudieron leer los intercambios archivados.", http.StatusInternalServerError)
+			return
+		}
+		if len(intercambios) == 0 {
+			responderError(w, correlationID, "ERR_SIN_INTERCAMBIOS", fmt.Sprintf("No hay intercambios con SUNAT archivados para %s.", nombreBase), http.StatusNotFound)
+			return
+		}
+		responderJSON(w, http.StatusOK, RespuestaIntercambios{Status: "success", CorrelationId: correlationID, DocumentId: nombreBase, Intercambios: intercambios})
+	}
+}
+
+// peticionValidez es el cuerpo de POST /comprobantes/validez.
+type peticionValidez struct {
+	// RUCConsultante es el emisor configurado con cuyas credenciales se consulta. Puede
+	// omitirse si hay un solo emisor configurado.
+	RUCConsultante string `json:"rucConsultante"`
+	ConsultaValidez
+}
+
+// validezHandler responde POST /comprobantes/validez: consulta en SUNAT si el comprobante de
+// un proveedor es válido, junto con el estado y la condición de domicilio de su RUC.
+func validezHandler(clientes map[string]*Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		correlationID := uuid.New().String()
+		ctx := conCorrelacion(r.Context(), correlationID)
+
+		var pet peticionValidez
+		if err := json.NewDecoder(r.Body).Decode(&pet); err != nil {
+			responderError(w, correlationID, "ERR_JSON_INVALIDO", "El cuerpo de la petición no es un JSON válido.", http.StatusBadRequest)
+			return
+		}
+		if pet.RUCConsultante == "" && len(clientes) == 1 {
+			for ruc := range clientes {
+				pet.RUCConsultante = ruc
+			}
+		}
+		cliente, ok := clientes[pet.RUCConsultante]
+		if !ok {
+			responderError(w, correlationID, "ERR_EMISOR_NO_CONFIGURADO", fmt.Sprintf("El emisor %q no está configurado.", pet.RUCConsultante), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := ValidarRUC(pet.RUCEmisor); err != nil {
+			responderError(w, correlationID, "ERR_COMPROBANTE_INVALIDO", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resultado, err := cliente.ValidarComprobante(ctx, pet.ConsultaValidez)
+		if err != nil {
+			log.Printf("[%s] Error consultando la validez de %s-%s-%s-%s: %v", correlationID, pet.RUCEmisor, pet.TipoComprobante, pet.Serie, pet.Numero, err)
+			responderErrorEnvio(w, correlationID, err)
+			return
+		}
+		responderJSON(w, http.StatusOK, RespuestaValidez{Status: "success", CorrelationId: correlationID, Valido: resultado.Valido(), Resultado: resultado})
+	}
+}
+
+// peticionLote es el cuerpo de POST /lotes.
+type peticionLote struct {
+	Documentos []DocumentoElectronico `json:"documentos"`
+}
+
+// errorDocumentoLote indica qué documento del lote no pasó la validación.
+type errorDocumentoLote struct {
+	Indice     int               `json:"indice"`
+	DocumentId string            `json:"documentId"`
+	Errores    []ErrorValidacion `json:"errores"`
+}
+
+var regexTicket = regexp.MustCompile(`^[0-9]{1,20}$`)
+
+// enviarLoteHandler responde POST /lotes: valida y firma todos los documentos (del mismo
+// emisor), los envía en un solo ZIP con sendPack y devuelve el ticket de SUNAT. Si un
+// documento no pasa la validación no se envía ninguno.
+func enviarLoteHandler(clientes map[string]*Client, firmas *AlmacenFirmas) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		correlationID := uuid.New().String()
+		ctx := conCorrelacion(r.Context(), correlationID)
+
+		var pet peticionLote
+		if err := json.NewDecoder(r.Body).Decode(&pet); err != nil {
+			responderError(w, correlationID, "ERR_JSON_INVALIDO", "El cuerpo de la petición no es un JSON válido.", http.StatusBadRequest)
+			return
+		}
+		if len(pet.Documentos) == 0 || len(pet.Documentos) > maxDocumentosLote {
+			responderError(w, correlationID, "ERR_LOTE_INVALIDO", fmt.Sprintf("El lote debe tener entre 1 y %d documentos.", maxDocumentosLote), http.StatusBadRequest)
+			return
+		}
+		ruc := pet.Documentos[0].Emisor.RUC
+		sunatClient, ok := clientes[ruc]
+		if !ok {
+			responderError(w, correlationID, "ERR_EMISOR_NO_CONFIGURADO", fmt.Sprintf("El emisor %s no está configurado para enviar comprobantes.", ruc), http.StatusUnprocessableEntity)
+			return
+		}
+		for _, d := range pet.Documentos {
+			if d.Emisor.RUC != ruc {
+				responderError(w, correlationID, "ERR_LOTE_INVALIDO", "Todos los documentos de un lote deben ser del mismo emisor.", http.StatusBadRequest)
+				return
+			}
+		}
+		log.Printf("[%s] Petición de envío por lote recibida: %d documentos del emisor %s", correlationID, len(pet.Documentos), ruc)
+
+		var rechazados []errorDocumentoLote
+		for i := range pet.Documentos {
+			d := &pet.Documentos[i]
+			completarDirecciones(d)
+			if errs := ValidarDocumento(d, time.Now(), sunatClient.Entorno.Nombre).Errores(); len(errs) > 0 {
+				rechazados = append(rechazados, errorDocumentoLote{Indice: i, DocumentId: d.Serie + "-" + d.Correlativo, Errores: errs})
+			}
+		}
+		if len(rechazados) > 0 {
+			log.Printf("[%s] %d documentos del lote incumplen reglas de validación", correlationID, len(rechazados))
+			responderJSON(w, http.StatusUnprocessableEntity, struct {
+				RespuestaError
+				Documentos []errorDocumentoLote `json:"documentos"`
+			}{RespuestaError{Status: "error", CorrelationId: correlationID, ErrorCode: "ERR_VALIDACION", ErrorMessage: "Hay documentos del lote que no cumplen las reglas de validación de SUNAT."}, rechazados})
+			return
+		}
+
+		archivos := make([]ArchivoZip, 0, len(pet.Documentos))
+		documentos := make([]string, 0, len(pet.Documentos))
+		for i := range pet.Documentos {
+			d := &pet.Documentos[i]
+			xmlFirmado, err := ProcesarDocumento(d, firmas)
+			var errFirma *ErrorFirma
+			if errors.As(err, &errFirma) {
+				log.Printf("[%s] %v", correlationID, err)
+				responderError(w, correlationID, "ERR_CERTIFICADO_FIRMA", err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			if err != nil {
+				log.Printf("[%s] Error procesando documento %s-%s: %v", correlationID, d.Serie, d.Correlativo, err)
+				responderError(w, correlationID, "ERR_PROCESAMIENTO", fmt.Sprintf("%s-%s: %v", d.Serie, d.Correlativo, err), http.StatusInternalServerError)
+				return
+			}
+			nombreBase := fmt.Sprintf("%s-%s-%s-%s", ruc, d.TipoDocumento, d.Serie, d.Correlativo)
+			if err := os.WriteFile(fmt.Sprintf("./storage/%s.xml", nombreBase), xmlFirmado, 0644); err != nil {
+				log.Printf("[%s] Error guardando archivo XML local: %v", correlationID, err)
+			}
+			archivos = append(archivos, ArchivoZip{Nombre: nombreBase + ".xml", Datos: xmlFirmado})
+			documentos = append(documentos, nombreBase)
+		}
+
+		zipData, err := crearZipMultiple(archivos)
+		if err != nil {
+			log.Printf("[%s] Error empaquetando el lote: %v", correlationID, err)
+			responderError(w, correlationID, "ERR_PROCESAMIENTO", "No se pudo empaquetar el lote.", http.StatusInternalServerError)
+			return
+		}
+		lote, err := reservarLote("./storage", ruc, time.Now(), zipData)
+		if err != nil {
+			log.Printf("[%s] %v", correlationID, err)
+			responderError(w, correlationID, "ERR_ALMACENAMIENTO", "No se pudo reservar el número de lote.", http.StatusInternalServerError)
+			return
+		}
+
+		ticket, err := sunatClient.EnviarLote(ctx, lote, zipData)
+		if err != nil {
+			log.Printf("[%s] Error en el envío del lote %s a SUNAT: %v", correlationID, lote, err)
+			if loteNoRecibido(err) {
+				if err := os.Remove(fmt.Sprintf("./storage/%s.zip", lote)); err != nil {
+					log.Printf("[%s] Error liberando el lote %s: %v", correlationID, lote, err)
+				}
+			}
+			responderErrorEnvio(w, correlationID, err)
+			return
+		}
+		log.Printf("[%s] Lote %s recibido por SUNAT con ticket %s", correlationID, lote, ticket)
+		responderJSON(w, http.StatusAccepted, RespuestaLote{Status: "success", CorrelationId: correlationID, Lote: lote, Ticket: ticket, Documentos: documentos})
+	}
+}
+
+// ticketLoteHandler responde GET /lotes/{ruc}/{ticket} con el estado del lote. Cuando SUNAT
+// terminó de procesarlo guarda el CDR de cada comprobante en ./storage.
+func ticketLoteHandler(clientes map[string]*Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		correlationID := uuid.New().String()
+		ctx := conCorrelacion(r.Context(), correlationID)
+		ruc, ticket := r.PathValue("ruc"), r.PathValue("ticket")
+		sunatClient, ok := clientes[ruc]
+		if !ok {
+			responderError(w, correlationID, "ERR_EMISOR_NO_CONFIGURADO", fmt.Sprintf("El emisor %s no está configurado para enviar comprobantes.", ruc), http.StatusUnprocessableEntity)
+			return
+		}
+		if !regexTicket.MatchString(ticket) {
+			responderError(w, correlationID, "ERR_TICKET_INVALIDO", fmt.Sprintf("%q no es un ticket válido.", ticket), http.StatusBadRequest)
+			return
+		}
+
+		estado, err := sunatClient.ConsultarTicket(ctx, ticket)
+		if err != nil {
+			log.Printf("[%s] Error consultando el ticket %s: %v", correlationID, ticket, err)
+			responderErrorEnvio(w, correlationID, err)
+			return
+		}
+		for _, cdr := range estado.CDRs {
+			if !strings.HasPrefix(cdr.Archivo, "R-"+ruc+"-") {
+				log.Printf("[%s] Se ignora el CDR %q del ticket %s: no corresponde al emisor", correlationID, cdr.Archivo, ticket)
+				continue
+			}
+			nombreBase := strings.TrimSuffix(strings.TrimPrefix(cdr.Archivo, "R-"), ".xml")
+			xmlEnviado, _ := os.ReadFile(filepath.Join("./storage", nombreBase+".xml"))
+			_, _, serie, numero, _ := partesNombreArchivo(nombreBase + ".xml")
+			if err := sunatClient.verificarCDR(cdr, serie+"-"+numero, xmlEnviado); err != nil {
+				log.Printf("[%s] Se ignora el CDR %q del ticket %s: %v", correlationID, cdr.Archivo, ticket, err)
+				continue
+			}
+			if err := os.WriteFile(filepath.Join("./storage", cdr.Archivo), cdr.XML, 0644); err != nil {
+				log.Printf("[%s] Error guardando archivo CDR: %v", correlationID, err)
+			}
+		}
+		responderJSON(w, http.StatusOK, estado)
+	}
+}
+
+// colasHandler responde GET /sunat/colas con cuántas llamadas esperan turno y cuántas están
+// en curso hacia cada endpoint, para ver la contrapresión en los picos.
+func colasHandler(clientes map[string]*Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Los emisores suelen compartir los mismos limitadores; cada uno se lista una vez.
+		vistos := map[*limitadores]bool{}
+		colas := []EstadoCola{}
+		for _, c := range clientes {
+			if c.limites == nil || vistos[c.limites] {
+				continue
+			}
+			vistos[c.limites] = true
+			colas = append(colas, c.limites.estado()...)
+		}
+		responderJSON(w, http.StatusOK, RespuestaColas{Status: "success", Colas: colas})
+	}
+}
+
+// resumenCatalogo es lo que se lista en GET /catalogos, sin las entradas.
+type resumenCatalogo struct {
+	Numero string `json:"numero"`
+	Nombre string `json:"nombre"`
+}
+
+// listarCatalogosHandler responde GET /catalogos con los catálogos disponibles.
+func listarCatalogosHandler(w http.ResponseWriter, r *http.Request) {
+	lista := catalogos.Listar()
+	resumen := make([]resumenCatalogo, 0, len(lista))
+	for _, c := range lista {
+		resumen = append(resumen, resumenCatalogo{Numero: c.Numero, Nombre: c.Nombre})
+	}
+	responderJSON(w, http.StatusOK, resumen)
+}
+
+// catalogoHandler responde GET /catalogos/{numero} con todas las entradas del catálogo,
+// o solo con una si se indica ?codigo=.
+func catalogoHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := catalogos.Obtener(r.PathValue("numero"))
+	if !ok {
+		responderError(w, uuid.New().String(), "ERR_CATALOGO_NO_EXISTE", fmt.Sprintf("No existe el catálogo %q.", r.PathValue("numero")), http.StatusNotFound)
+		return
+	}
+	if codigo := r.URL.Query().Get("codigo"); codigo != "" {
+		entrada, ok := c.Buscar(codigo)
+		if !ok {
+			responderError(w, uuid.New().String(), "ERR_CODIGO_NO_EXISTE", fmt.Sprintf("El código %q no existe en el catálogo %s.", codigo, c.Numero), http.StatusNotFound)
+			return
+		}
+		responderJSON(w, http.StatusOK, entrada)
+		return
+	}
+	responderJSON(w, http.StatusOK, c)
+}
+
+// ubigeoHandler responde GET /ubigeos/{codigo} con el distrito del catálogo del INEI.
+func ubigeoHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := catalogos.BuscarUbigeo(r.PathValue("codigo"))
+	if !ok {
+		responderError(w, uuid.New().String(), "ERR_UBIGEO_NO_EXISTE", fmt.Sprintf("No existe el ubigeo %q.", r.PathValue("codigo")), http.StatusNotFound)
+		return
+	}
+	responderJSON(w, http.StatusOK, u)
+}
+
+func responderJSON(w http.ResponseWriter, httpStatus int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(v)
+}
+
+// responderErrorEnvio traduce un error del envío a SUNAT a la respuesta de la API. Los SOAP
+// fault llevan el código de SUNAT y si conviene reintentar; el resto son fallas de
+// comunicación con el servicio.
+func responderErrorEnvio(w http.ResponseWriter, corrID string, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		// El cliente se desconectó o el servidor se está apagando: nadie leerá la respuesta,
+		// pero queda el registro. SUNAT pudo haber recibido el comprobante.
+		responderError(w, corrID, "ERR_CANCELADO", err.Error(), http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		responderError(w, corrID, "ERR_SUNAT_TIEMPO_AGOTADO", err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	var errCola *ErrorCola
+	if errors.As(err, &errCola) {
+		// La llamada no llegó a salir: se puede reintentar sin riesgo de duplicar.
+		responderJSON(w, http.StatusServiceUnavailable, RespuestaError{Status: "error", CorrelationId: corrID, ErrorCode: "ERR_SUNAT_SATURADO", ErrorMessage: err.Error(), Reintentable: true})
+		return
+	}
+	var errCDR *ErrorCDR
+	if errors.As(err, &errCDR) {
+		responderError(w, corrID, "ERR_CDR_INVALIDO", err.Error(), http.StatusBadGateway)
+		return
+	}
+	var errSunat *ErrorSUNAT
+	if !errors.As(err, &errSunat) {
+		responderError(w, corrID, "ERR_ENVIO_SUNAT", err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	codigo, estado := "ERR_SUNAT_RECHAZO", http.StatusUnprocessableEntity
+	switch {
+	case errSunat.Reintentable:
+		codigo, estado = "ERR_SUNAT_NO_DISPONIBLE", http.StatusServiceUnavailable
+	case errSunat.Autenticacion():
+		codigo, estado = "ERR_SUNAT_AUTENTICACION", http.StatusBadGateway
+	case errSunat.YaRegistrado():
+		codigo, estado = "ERR_SUNAT_YA_REGISTRADO", http.StatusConflict
+	}
+	respuesta := RespuestaError{
+		Status:        "error",
+		CorrelationId: corrID,
+		ErrorCode:     codigo,
+		ErrorMessage:  redactar(errSunat.Error()),
+		CodigoSunat:   errSunat.Codigo,
+		Reintentable:  errSunat.Reintentable,
+	}
+	responderJSON(w, estado, respuesta)
+}
+
 func responderError(w http.ResponseWriter, corrID, errCode, errMsg string, httpStatus int) {
-	respuesta := RespuestaError{Status: "error", CorrelationId: corrID, ErrorCode: errCode, ErrorMessage: errMsg}
+	respuesta := RespuestaError{Status: "error", CorrelationId: corrID, ErrorCode: errCode, ErrorMessage: redactar(errMsg)}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(httpStatus)
 	json.NewEncoder(w).Encode(respuesta)
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Intercambio es una llamada SOAP a SUNAT tal como ocurrió: el sobre enviado (con el
+// wsse:Password redactado), la respuesta HTTP sin procesar, sus cabeceras y cuánto tardó.
+// Es lo que se presenta ante un reclamo, así que la respuesta no se interpreta ni se recorta.
+type Intercambio struct {
+	Operacion         string      `json:"operacion"`
+	URL               string      `json:"url"`
+	Inicio            time.Time   `json:"inicio"`
+	DuracionMs        int64       `json:"duracionMs"`
+	CabecerasPeticion http.Header `json:"cabecerasPeticion"`
+	Peticion          string      `json:"peticion"`
+	// EstadoHTTP, Cabeceras y Respuesta quedan vacíos si la petición no llegó a responderse.
+	EstadoHTTP int         `json:"estadoHttp,omitempty"`
+	Cabeceras  http.Header `json:"cabeceras,omitempty"`
+	Respuesta  string      `json:"respuesta,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// archivoIntercambios guarda los intercambios de cada documento junto a su XML, en
+// <dir>/<documento>.soap.jsonl: una línea JSON por llamada, en el orden en que se hicieron.
+type archivoIntercambios struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func (a *archivoIntercambios) ruta(documento string) string {
+	return filepath.Join(a.dir, documento+".soap.jsonl")
+}
+
+// registrar agrega el intercambio al archivo del documento. Un fallo al archivar se
+// registra en el log pero no interrumpe el envío: el comprobante ya está en SUNAT.
+func (a *archivoIntercambios) registrar(documento string, i Intercambio) {
+	if a == nil || documento == "" {
+		return
+	}
+	i.Peticion = redactarPasswordWSSE(i.Peticion)
+	linea, err := json.Marshal(i)
+	if err != nil {
+		log.Printf("No se pudo archivar el intercambio %s de %s: %v", i.Operacion, documento, err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.OpenFile(a.ruta(documento), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("No se pudo archivar el intercambio %s de %s: %v", i.Operacion, documento, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(linea, '\n')); err != nil {
+		log.Printf("No se pudo archivar el intercambio %s de %s: %v", i.Operacion, documento, err)
+	}
+}
+
+// leer devuelve los intercambios archivados del documento, del más antiguo al más reciente.
+// Si el documento no tiene ninguno devuelve una lista vacía sin error.
+func (a *archivoIntercambios) leer(documento string) ([]Intercambio, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.Open(a.ruta(documento))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var intercambios []Intercambio
+	lector := bufio.NewScanner(f)
+	// Las respuestas traen el ZIP del CDR en base64; una línea puede pasar de varios MB.
+	lector.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for lector.Scan() {
+		var i Intercambio
+		if err := json.Unmarshal(lector.Bytes(), &i); err != nil {
+			return nil, fmt.Errorf("%s: línea %d dañada: %w", a.ruta(documento), len(intercambios)+1, err)
+		}
+		intercambios = append(intercambios, i)
+	}
+	return intercambios, lector.Err()
+}
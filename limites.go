@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConfigLimites controla cuántas llamadas salen hacia cada endpoint de SUNAT (o del OSE).
+// En los cierres de mes, sin límite, cada petición abre su propia llamada y SUNAT empieza
+// a estrangular o a no responder; con límite, las llamadas que sobran esperan en cola.
+type ConfigLimites struct {
+	// Concurrencia es el máximo de llamadas simultáneas a un mismo endpoint.
+	Concurrencia int `json:"concurrencia"`
+	// PorSegundo es el ritmo sostenido de llamadas por endpoint (0 = sin límite de ritmo) y
+	// Rafaga cuántas pueden salir juntas tras un rato sin tráfico (token bucket).
+	PorSegundo float64 `json:"porSegundo"`
+	Rafaga     int     `json:"rafaga"`
+	// EsperaMaximaMs es cuánto puede esperar una llamada en cola antes de rendirse.
+	EsperaMaximaMs int `json:"esperaMaximaMs"`
+}
+
+var limitesPorDefecto = ConfigLimites{Concurrencia: 10, EsperaMaximaMs: 30000}
+
+// completar reemplaza los valores no configurados por los límites por defecto.
+func (l ConfigLimites) completar() ConfigLimites {
+	if l.Concurrencia <= 0 {
+		l.Concurrencia = limitesPorDefecto.Concurrencia
+	}
+	if l.EsperaMaximaMs <= 0 {
+		l.EsperaMaximaMs = limitesPorDefecto.EsperaMaximaMs
+	}
+	if l.PorSegundo > 0 && l.Rafaga <= 0 {
+		l.Rafaga = max(1, int(l.PorSegundo))
+	}
+	return l
+}
+
+// ErrorCola indica que la llamada no consiguió turno hacia el endpoint dentro de la espera
+// máxima: SUNAT no llegó a recibirla, así que puede reintentarse más tarde sin riesgo.
+type ErrorCola struct {
+	Endpoint string
+	Espera   time.Duration
+	EnCola   int64
+}
+
+func (e *ErrorCola) Error() string {
+	return fmt.Sprintf("la llamada a %s esperó %s en cola sin turno (%d en cola)", e.Endpoint, e.Espera, e.EnCola)
+}
+
+// EstadoCola es la foto de un endpoint que muestra GET /sunat/colas.
+type EstadoCola struct {
+	Endpoint     string  `json:"endpoint"`
+	EnCola       int64   `json:"enCola"`
+	EnCurso      int64   `json:"enCurso"`
+	Concurrencia int     `json:"concurrencia"`
+	PorSegundo   float64 `json:"porSegundo,omitempty"`
+	// Rechazadas son las llamadas que se rindieron por superar la espera máxima.
+	Rechazadas int64 `json:"rechazadas"`
+}
+
+// limitadores guarda un limitador por endpoint. Lo comparten todos los emisores: el límite
+// es de SUNAT por servicio, no por RUC.
+type limitadores struct {
+	cfg    ConfigLimites
+	mu     sync.Mutex
+	porURL map[string]*limitador
+}
+
+func nuevosLimitadores(cfg ConfigLimites) *limitadores {
+	return &limitadores{cfg: cfg.completar(), porURL: map[string]*limitador{}}
+}
+
+// adquirir espera turno para llamar a endpoint y devuelve la función que lo libera. Si el
+// turno no llega dentro de la espera máxima devuelve *ErrorCola; si ctx se cancela antes,
+// el error de ctx. Con l en nil no hay límite.
+func (l *limitadores) adquirir(ctx context.Context, endpoint string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	lim, ok := l.porURL[endpoint]
+	if !ok {
+		lim = &limitador{turnos: make(chan struct{}, l.cfg.Concurrencia), tokens: float64(l.cfg.Rafaga), ultimo: time.Now()}
+		l.porURL[endpoint] = lim
+	}
+	l.mu.Unlock()
+
+	espera := time.Duration(l.cfg.EsperaMaximaMs) * time.Millisecond
+	enCola := lim.enCola.Add(1)
+	defer lim.enCola.Add(-1)
+
+	ctxCola, cancel := context.WithTimeout(ctx, espera)
+	defer cancel()
+	err := lim.esperarTurno(ctxCola, l.cfg)
+	if err == nil {
+		lim.enCurso.Add(1)
+		return func() {
+			lim.enCurso.Add(-1)
+			<-lim.turnos
+		}, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		lim.rechazadas.Add(1)
+		return nil, &ErrorCola{Endpoint: endpoint, Espera: espera, EnCola: enCola}
+	}
+	return nil, err
+}
+
+// estado devuelve una foto de las colas, ordenada por endpoint.
+func (l *limitadores) estado() []EstadoCola {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	colas := make([]EstadoCola, 0, len(l.porURL))
+	for endpoint, lim := range l.porURL {
+		colas = append(colas, EstadoCola{
+			Endpoint:     endpoint,
+			EnCola:       lim.enCola.Load(),
+			EnCurso:      lim.enCurso.Load(),
+			Concurrencia: l.cfg.Concurrencia,
+			PorSegundo:   l.cfg.PorSegundo,
+			Rechazadas:   lim.rechazadas.Load(),
+		})
+	}
+	slices.SortFunc(colas, func(a, b EstadoCola) int { return cmp.Compare(a.Endpoint, b.Endpoint) })
+	return colas
+}
+
+// limitador combina un semáforo (turnos) con un token bucket para un endpoint.
+type limitador struct {
+	turnos chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	ultimo time.Time
+
+	enCola, enCurso, rechazadas atomic.Int64
+}
+
+// esperarTurno ocupa un lugar del semáforo y, si hay límite de ritmo, consume un token.
+// Si ctx vence mientras espera el token, devuelve el lugar del semáforo.
+func (lim *limitador) esperarTurno(ctx context.Context, cfg ConfigLimites) error {
+	select {
+	case lim.turnos <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if cfg.PorSegundo <= 0 {
+		return nil
+	}
+	for {
+		lim.mu.Lock()
+		ahora := time.Now()
+		lim.tokens = min(float64(cfg.Rafaga), lim.tokens+ahora.Sub(lim.ultimo).Seconds()*cfg.PorSegundo)
+		lim.ultimo = ahora
+		if lim.tokens >= 1 {
+			lim.tokens--
+			lim.mu.Unlock()
+			return nil
+		}
+		falta := time.Duration((1 - lim.tokens) / cfg.PorSegundo * float64(time.Second))
+		lim.mu.Unlock()
+		if err := esperar(ctx, falta); err != nil {
+			<-lim.turnos
+			return err
+		}
+	}
+}
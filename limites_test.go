@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompletarLimites(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		cfg      ConfigLimites
+		esperado ConfigLimites
+	}{
+		{"vacío", ConfigLimites{}, limitesPorDefecto},
+		{"ritmo sin ráfaga", ConfigLimites{Concurrencia: 2, PorSegundo: 5}, ConfigLimites{Concurrencia: 2, PorSegundo: 5, Rafaga: 5, EsperaMaximaMs: 30000}},
+		{"ritmo menor a uno", ConfigLimites{PorSegundo: 0.5}, ConfigLimites{Concurrencia: 10, PorSegundo: 0.5, Rafaga: 1, EsperaMaximaMs: 30000}},
+		{"ráfaga explícita", ConfigLimites{PorSegundo: 5, Rafaga: 2, EsperaMaximaMs: 100}, ConfigLimites{Concurrencia: 10, PorSegundo: 5, Rafaga: 2, EsperaMaximaMs: 100}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			if got := c.cfg.completar(); got != c.esperado {
+				t.Errorf("completar() = %+v, se esperaba %+v", got, c.esperado)
+			}
+		})
+	}
+}
+
+func TestAdquirirSinLimites(t *testing.T) {
+	var l *limitadores
+	liberar, err := l.adquirir(context.Background(), "http://sunat/billService")
+	if err != nil {
+		t.Fatal(err)
+	}
+	liberar()
+}
+
+func TestAdquirirConcurrencia(t *testing.T) {
+	const endpoint = "http://sunat/billService"
+	l := nuevosLimitadores(ConfigLimites{Concurrencia: 2, EsperaMaximaMs: 30})
+	ctx := context.Background()
+
+	var liberaciones []func()
+	for i := 0; i < 2; i++ {
+		liberar, err := l.adquirir(ctx, endpoint)
+		if err != nil {
+			t.Fatalf("turno %d: %v", i+1, err)
+		}
+		liberaciones = append(liberaciones, liberar)
+	}
+
+	// El tercero no consigue turno dentro de la espera máxima.
+	_, err := l.adquirir(ctx, endpoint)
+	var errCola *ErrorCola
+	if !errors.As(err, &errCola) {
+		t.Fatalf("tercer turno: %v, se esperaba *ErrorCola", err)
+	}
+	if errCola.Endpoint != endpoint || errCola.Espera != 30*time.Millisecond || errCola.EnCola != 1 {
+		t.Errorf("ErrorCola = %+v", errCola)
+	}
+
+	// Otro endpoint tiene su propio límite.
+	liberarOtro, err := l.adquirir(ctx, "http://sunat/billConsultService")
+	if err != nil {
+		t.Fatalf("otro endpoint: %v", err)
+	}
+	liberarOtro()
+
+	estado := l.estado()
+	// Ordenado por endpoint: billConsultService va antes que billService.
+	if len(estado) != 2 || estado[1].Endpoint != endpoint {
+		t.Fatalf("estado() = %+v", estado)
+	}
+	if e := estado[1]; e.EnCurso != 2 || e.EnCola != 0 || e.Rechazadas != 1 || e.Concurrencia != 2 {
+		t.Errorf("estado de %s = %+v", endpoint, e)
+	}
+
+	// Al liberar un turno, el siguiente pasa.
+	liberaciones[0]()
+	liberar, err := l.adquirir(ctx, endpoint)
+	if err != nil {
+		t.Fatalf("turno tras liberar: %v", err)
+	}
+	liberar()
+	liberaciones[1]()
+	if e := l.estado()[1]; e.EnCurso != 0 {
+		t.Errorf("quedaron %d llamadas en curso después de liberar todas", e.EnCurso)
+	}
+}
+
+func TestAdquirirEnCola(t *testing.T) {
+	const endpoint = "http://sunat/billService"
+	l := nuevosLimitadores(ConfigLimites{Concurrencia: 1, EsperaMaximaMs: 5000})
+	liberar, err := l.adquirir(context.Background(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obtenido := make(chan error, 1)
+	go func() {
+		liberar, err := l.adquirir(context.Background(), endpoint)
+		if err == nil {
+			liberar()
+		}
+		obtenido <- err
+	}()
+	limite := time.Now().Add(2 * time.Second)
+	for l.estado()[0].EnCola != 1 {
+		if time.Now().After(limite) {
+			t.Fatal("la segunda llamada no quedó en cola")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	liberar()
+	if err := <-obtenido; err != nil {
+		t.Errorf("la llamada en cola no obtuvo turno al liberarse el anterior: %v", err)
+	}
+}
+
+func TestAdquirirCancelado(t *testing.T) {
+	const endpoint = "http://sunat/billService"
+	l := nuevosLimitadores(ConfigLimites{Concurrencia: 1, EsperaMaximaMs: 5000})
+	liberar, err := l.adquirir(context.Background(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer liberar()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = l.adquirir(ctx, endpoint)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("adquirir con el contexto cancelado = %v, se esperaba context.Canceled", err)
+	}
+	// La cancelación del cliente no cuenta como rechazo por cola llena.
+	if e := l.estado()[0]; e.Rechazadas != 0 || e.EnCola != 0 {
+		t.Errorf("estado = %+v", e)
+	}
+}
+
+func TestAdquirirRitmo(t *testing.T) {
+	const endpoint = "http://sunat/billService"
+	l := nuevosLimitadores(ConfigLimites{Concurrencia: 10, PorSegundo: 20, Rafaga: 2, EsperaMaximaMs: 5000})
+	ctx := context.Background()
+
+	inicio := time.Now()
+	for i := 0; i < 3; i++ {
+		liberar, err := l.adquirir(ctx, endpoint)
+		if err != nil {
+			t.Fatalf("llamada %d: %v", i+1, err)
+		}
+		liberar()
+	}
+	// Las dos primeras salen con la ráfaga; la tercera espera un token (50 ms a 20/s).
+	if d := time.Since(inicio); d < 40*time.Millisecond {
+		t.Errorf("tres llamadas con ráfaga 2 a 20/s tardaron %v, se esperaba al menos 50 ms", d)
+	}
+}
+
+func TestAdquirirRitmoDevuelveTurno(t *testing.T) {
+	const endpoint = "http://sunat/billService"
+	l := nuevosLimitadores(ConfigLimites{Concurrencia: 1, PorSegundo: 1, Rafaga: 1, EsperaMaximaMs: 30})
+	liberar, err := l.adquirir(context.Background(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	liberar()
+
+	// Hay lugar en el semáforo pero no token: vence la espera y el lugar debe devolverse.
+	_, err = l.adquirir(context.Background(), endpoint)
+	var errCola *ErrorCola
+	if !errors.As(err, &errCola) {
+		t.Fatalf("adquirir sin token = %v, se esperaba *ErrorCola", err)
+	}
+	if ocupados := len(l.porURL[endpoint].turnos); ocupados != 0 {
+		t.Errorf("quedaron %d lugares del semáforo ocupados tras rendirse esperando el token", ocupados)
+	}
+}
+
+func TestRutaAPI(t *testing.T) {
+	endpoint, clave := rutaAPI("https://api.sunat.gob.pe", "/v1/clientesextranet/{clientId}/oauth2/token/", "{clientId}", "a b/c")
+	if endpoint != "https://api.sunat.gob.pe/v1/clientesextranet/a%20b%2Fc/oauth2/token/" {
+		t.Errorf("endpoint = %q", endpoint)
+	}
+	if clave != "https://api.sunat.gob.pe/v1/clientesextranet/{clientId}/oauth2/token/" {
+		t.Errorf("clave = %q", clave)
+	}
+
+	// Dos RUC distintos comparten el limitador del servicio.
+	_, clave1 := rutaAPI("https://api.sunat.gob.pe", "/v1/contribuyente/contribuyentes/{ruc}/validarcomprobante", "{ruc}", "20100066603")
+	_, clave2 := rutaAPI("https://api.sunat.gob.pe", "/v1/contribuyente/contribuyentes/{ruc}/validarcomprobante", "{ruc}", "20131312955")
+	if clave1 != clave2 {
+		t.Errorf("claves distintas por RUC: %q y %q", clave1, clave2)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// maxDocumentosLote es el máximo de comprobantes que SUNAT acepta en un envío por lote.
+const maxDocumentosLote = 500
+
+// Códigos de estado de getStatus para un ticket.
+const (
+	ticketProcesado           = "0"
+	ticketEnProceso           = "98"
+	ticketProcesadoConErrores = "99"
+)
+
+// EstadoTicket es el resultado de consultar el ticket de un lote (getStatus en billService).
+type EstadoTicket struct {
+	Ticket string `json:"ticket"`
+	// Codigo es 0 (procesado), 98 (en proceso) o 99 (procesado con errores).
+	Codigo    string `json:"codigo"`
+	EnProceso bool   `json:"enProceso"`
+	// CDRs trae una constancia por comprobante del lote cuando SUNAT terminó de procesarlo.
+	CDRs []*CDR `json:"cdrs,omitempty"`
+}
+
+// nombreLote arma el nombre del ZIP de un lote: RUC-LT-YYYYMMDD-n.
+func nombreLote(ruc string, fecha time.Time, secuencia int) string {
+	return fmt.Sprintf("%s%d", prefijoLote(ruc, fecha), secuencia)
+}
+
+// prefijoLote es la parte común a todos los lotes del emisor en el día: RUC-LT-YYYYMMDD-.
+func prefijoLote(ruc string, fecha time.Time) string {
+	return fmt.Sprintf("%s-LT-%s-", ruc, fecha.In(zonaLima).Format("20060102"))
+}
+
+// reservarLote toma el siguiente número de lote del día creando su ZIP en dir. El archivo se
+// crea con O_EXCL, así dos envíos simultáneos del mismo emisor, aun desde otro proceso, no
+// pueden obtener el mismo número, y la reserva queda en disco antes de hablar con SUNAT.
+func reservarLote(dir, ruc string, fecha time.Time, zipData []byte) (string, error) {
+	previos, err := filepath.Glob(filepath.Join(dir, prefijoLote(ruc, fecha)+"*.zip"))
+	if err != nil {
+		return "", err
+	}
+	for secuencia := len(previos) + 1; ; secuencia++ {
+		lote := nombreLote(ruc, fecha, secuencia)
+		f, err := os.OpenFile(filepath.Join(dir, lote+".zip"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("no se pudo reservar el lote %s: %w", lote, err)
+		}
+		_, err = f.Write(zipData)
+		if errCierre := f.Close(); err == nil {
+			err = errCierre
+		}
+		if err != nil {
+			return "", fmt.Errorf("no se pudo guardar el lote %s: %w", lote, err)
+		}
+		return lote, nil
+	}
+}
+
+// loteNoRecibido indica que el error del envío prueba que SUNAT no registró el lote, de modo
+// que su número puede volver a usarse. Ante una falla de comunicación no se sabe, y el
+// número se da por gastado.
+func loteNoRecibido(err error) bool {
+	var errCola *ErrorCola
+	var errSunat *ErrorSUNAT
+	return errors.As(err, &errCola) || errors.As(err, &errSunat) && !errSunat.Reintentable
+}
+
+// EnviarLote envía con sendPack el ZIP de un lote, el mismo que se guardó al reservar su
+// número con reservarLote, para que lo archivado sea byte a byte lo que recibió SUNAT.
+// SUNAT responde con un ticket que se resuelve luego con ConsultarTicket.
+//
+// A diferencia de EnviarFactura no se reintenta: no hay forma de preguntar por un lote cuyo
+// ticket nunca llegó, y reenviarlo entero duplicaría los comprobantes que sí se recibieron.
+func (c *Client) EnviarLote(ctx context.Context, lote string, zipData []byte) (string, error) {
+	if len(zipData) == 0 {
+		return "", fmt.Errorf("el lote %s no tiene contenido", lote)
+	}
+
+	respBody, err := c.llamarSOAP(ctx, "sendPack", lote, c.URL, construirSOAPSendPack(lote+".zip", zipData, c.Username, string(c.Password)))
+	if err != nil {
+		return "", err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(respBody); err != nil {
+		return "", fmt.Errorf("XML de respuesta SOAP mal formado: %w", err)
+	}
+	ticket := doc.FindElement("//ticket")
+	if ticket == nil || ticket.Text() == "" {
+		return "", fmt.Errorf("no se encontró el nodo <ticket> en la respuesta. Respuesta completa: %s", respBody)
+	}
+	return ticket.Text(), nil
+}
+
+// ConsultarTicket pregunta por el estado de un lote enviado con EnviarLote.
+func (c *Client) ConsultarTicket(ctx context.Context, ticket string) (*EstadoTicket, error) {
+	cuerpo := fmt.Sprintf(`<ser:getStatus><ticket>%s</ticket></ser:getStatus>`, ticket)
+	// La consulta no sabe a qué lote pertenece el ticket; se archiva bajo RUC-TK-ticket.
+	respBody, err := c.llamarSOAP(ctx, "getStatus", fmt.Sprintf("%s-TK-%s", c.RUC, ticket), c.URL, sobreSOAP(c.Username, string(c.Password), cuerpo))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(respBody); err != nil {
+		return nil, fmt.Errorf("XML de respuesta SOAP mal formado: %w", err)
+	}
+	nodo := doc.FindElement("//status")
+	if nodo == nil {
+		return nil, fmt.Errorf("no se encontró el nodo <status> en la respuesta")
+	}
+
+	estado := &EstadoTicket{Ticket: ticket, Codigo: textoDe(nodo, "statusCode")}
+	switch estado.Codigo {
+	case ticketEnProceso:
+		estado.EnProceso = true
+		return estado, nil
+	case ticketProcesado, ticketProcesadoConErrores:
+	default:
+		return nil, fmt.Errorf("estado de ticket desconocido %q", estado.Codigo)
+	}
+	if contenido := textoDe(nodo, "content"); contenido != "" {
+		cdrs, err := leerZipCDRs(contenido)
+		if err != nil {
+			return nil, err
+		}
+		estado.CDRs = cdrs
+	}
+	return estado, nil
+}
+
+func construirSOAPSendPack(nombreZip string, zipData []byte, usuario, password string) []byte {
+	zipBase64 := base64.StdEncoding.EncodeToString(zipData)
+	return sobreSOAP(usuario, password, fmt.Sprintf(`<ser:sendPack><fileName>%s</fileName><contentFile>%s</contentFile></ser:sendPack>`, nombreZip, zipBase64))
+}
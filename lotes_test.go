@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNombreLote(t *testing.T) {
+	// 03:00 UTC del 8 de enero todavía es 7 de enero en Lima.
+	fecha := time.Date(2025, 1, 8, 3, 0, 0, 0, time.UTC)
+	if got := nombreLote("20100066603", fecha, 3); got != "20100066603-LT-20250107-3" {
+		t.Errorf("nombreLote = %q", got)
+	}
+}
+
+func TestReservarLote(t *testing.T) {
+	dir := t.TempDir()
+	fecha := time.Date(2025, 1, 7, 12, 0, 0, 0, zonaLima)
+	// Un lote de otro emisor no cuenta para la secuencia.
+	if err := os.WriteFile(filepath.Join(dir, "20131312955-LT-20250107-1.zip"), []byte("PK"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, esperado := range []string{"20100066603-LT-20250107-1", "20100066603-LT-20250107-2"} {
+		lote, err := reservarLote(dir, "20100066603", fecha, []byte{'P', 'K', byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lote != esperado {
+			t.Errorf("lote %q, se esperaba %q", lote, esperado)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, lote+".zip"))
+		if err != nil || string(data) != string([]byte{'P', 'K', byte(i)}) {
+			t.Errorf("el ZIP reservado de %s no es el enviado: %q, %v", lote, data, err)
+		}
+	}
+
+	// Si se liberó un número intermedio, el siguiente no pisa un lote existente.
+	if err := os.Remove(filepath.Join(dir, "20100066603-LT-20250107-1.zip")); err != nil {
+		t.Fatal(err)
+	}
+	lote, err := reservarLote(dir, "20100066603", fecha, []byte("PK"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lote == "20100066603-LT-20250107-2" {
+		t.Errorf("se reutilizó el lote %s, que ya existe", lote)
+	}
+}
+
+func TestReservarLoteConcurrente(t *testing.T) {
+	dir := t.TempDir()
+	fecha := time.Date(2025, 1, 7, 12, 0, 0, 0, zonaLima)
+	const envios = 20
+	var wg sync.WaitGroup
+	lotes := make([]string, envios)
+	for i := range envios {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lote, err := reservarLote(dir, "20100066603", fecha, []byte("PK"))
+			if err != nil {
+				t.Error(err)
+			}
+			lotes[i] = lote
+		}()
+	}
+	wg.Wait()
+	vistos := map[string]bool{}
+	for _, l := range lotes {
+		if vistos[l] {
+			t.Errorf("el lote %s se reservó dos veces", l)
+		}
+		vistos[l] = true
+	}
+}
+
+func TestLoteNoRecibido(t *testing.T) {
+	casos := []struct {
+		nombre     string
+		err        error
+		noRecibido bool
+	}{
+		{"cola llena", &ErrorCola{}, true},
+		{"rechazo de SUNAT", &ErrorSUNAT{Codigo: "0151"}, true},
+		{"excepción reintentable", &ErrorSUNAT{Codigo: "0138", Reintentable: true}, false},
+		{"falla de red", errors.New("error al enviar la petición a SUNAT: EOF"), false},
+		{"HTTP 502", &errorHTTP{Estado: http.StatusBadGateway}, false},
+	}
+	for _, c := range casos {
+		if got := loteNoRecibido(c.err); got != c.noRecibido {
+			t.Errorf("%s: loteNoRecibido = %t, se esperaba %t", c.nombre, got, c.noRecibido)
+		}
+	}
+}
+
+func TestEnviarLote(t *testing.T) {
+	zipData, err := crearZipMultiple([]ArchivoZip{
+		{Nombre: "20100066603-01-F001-1.xml", Datos: []byte("<Invoice/>")},
+		{Nombre: "20100066603-01-F001-2.xml", Datos: []byte("<Invoice/>")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cuerpo string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		cuerpo = string(data)
+		io.WriteString(w, sobreRespuesta(`<br:sendPackResponse xmlns:br="http://service.sunat.gob.pe"><ticket>1736272800123</ticket></br:sendPackResponse>`))
+	}))
+	defer s.Close()
+
+	ticket, err := clientePrueba(s.URL).EnviarLote(context.Background(), "20100066603-LT-20250107-1", zipData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket != "1736272800123" {
+		t.Errorf("ticket %q", ticket)
+	}
+	if !strings.Contains(cuerpo, "<fileName>20100066603-LT-20250107-1.zip</fileName>") || !strings.Contains(cuerpo, base64.StdEncoding.EncodeToString(zipData)) {
+		t.Errorf("el sendPack no lleva el ZIP del lote: %s", cuerpo)
+	}
+
+	if _, err := clientePrueba(s.URL).EnviarLote(context.Background(), "20100066603-LT-20250107-2", nil); err == nil {
+		t.Error("se esperaba un error con un lote vacío")
+	}
+}
+
+func TestConsultarTicket(t *testing.T) {
+	zipData, err := crearZipMultiple([]ArchivoZip{
+		{Nombre: "R-20100066603-01-F001-1.xml", Datos: cdrPrueba("0")},
+		{Nombre: "R-20100066603-01-F001-2.xml", Datos: cdrPrueba("2800")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	casos := []struct {
+		nombre, estado, contenido string
+		enProceso                 bool
+		cdrs                      int
+		error                     bool
+	}{
+		{nombre: "en proceso", estado: ticketEnProceso, enProceso: true},
+		{nombre: "procesado", estado: ticketProcesadoConErrores, contenido: base64.StdEncoding.EncodeToString(zipData), cdrs: 2},
+		{nombre: "estado desconocido", estado: "0127", error: true},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			s := nuevoServidorSUNAT(t, func(string, int) (int, string) {
+				return http.StatusOK, sobreRespuesta(`<br:getStatusResponse xmlns:br="http://service.sunat.gob.pe"><status><statusCode>` + c.estado + `</statusCode><content>` + c.contenido + `</content></status></br:getStatusResponse>`)
+			})
+			estado, err := clientePrueba(s.URL).ConsultarTicket(context.Background(), "1736272800123")
+			if (err != nil) != c.error {
+				t.Fatalf("error %v, se esperaba error %t", err, c.error)
+			}
+			if err != nil {
+				return
+			}
+			if estado.EnProceso != c.enProceso || len(estado.CDRs) != c.cdrs {
+				t.Errorf("estado %+v", estado)
+			}
+			if c.cdrs == 2 && (estado.CDRs[0].Estado != CDRAceptado || estado.CDRs[1].Estado != CDRRechazado) {
+				t.Errorf("CDRs mal clasificados: %s, %s", estado.CDRs[0].Estado, estado.CDRs[1].Estado)
+			}
+		})
+	}
+}
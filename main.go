@@ -1,35 +1,103 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os" // Asegúrate de tener esta importación
-)
-
-// Variables de configuración para las credenciales de SUNAT
-// Es mejor sacarlas del código para poder cambiarlas fácilmente.
-const (
-	RUC_EMISOR = "20601546913" // Tu RUC de prueba
-	USER_SOL   = "MODDATOS"    // Tu usuario SOL de prueba
-	PASS_SOL   = "MODDATOS"    // Tu clave SOL de prueba (el cliente la ignora y usa el RUC para el billService)
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	// Crear el cliente de SUNAT una sola vez.
-	sunatClient := NewClient(RUC_EMISOR, USER_SOL, PASS_SOL)
+	// Ninguna línea del log debe mostrar una clave SOL ni el contenido de wsse:Password.
+	log.SetOutput(escritorRedactado{destino: os.Stderr})
+
+	// Crear un cliente de SUNAT por emisor, una sola vez, según la configuración.
+	cfg, err := cargarConfiguracion()
+	if err != nil {
+		log.Fatalf("Error en la configuración: %v", err)
+	}
+	clientes, err := crearClientes(cfg)
+	if err != nil {
+		log.Fatalf("Error en la configuración: %v", err)
+	}
+
+	// "mi-conversor-ubl diagnostico" solo prueba la conexión con los servicios y termina. Va
+	// antes de cargar los certificados: sirve para revisar la red aunque la firma no esté
+	// lista todavía.
+	if len(os.Args) > 1 && os.Args[1] == "diagnostico" {
+		if !diagnosticar(context.Background(), clientes, os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Los certificados se cargan al arrancar para no descubrir en el primer comprobante que
+	// la clave de un .pfx es incorrecta.
+	firmas, err := NuevoAlmacenFirmas(cfg)
+	if err != nil {
+		log.Fatalf("Error en el certificado de firma: %v", err)
+	}
+	firmas.advertirCertificados(time.Now())
+	for ruc, c := range clientes {
+		log.Printf("Emisor %s configurado en el entorno %q (%s)", ruc, c.Entorno.Nombre, c.URL)
+	}
 
 	// Crear el directorio de almacenamiento si no existe
 	if err := os.MkdirAll("./storage", 0755); err != nil {
 		log.Fatalf("No se pudo crear el directorio de almacenamiento: %v", err)
 	}
 
-	// Inyectar el cliente al handler
-	http.HandleFunc("/convertir", convertirHandler(sunatClient))
+	// Inyectar los clientes al handler
+	http.HandleFunc("/convertir", convertirHandler(clientes, firmas))
+	http.HandleFunc("GET /catalogos", listarCatalogosHandler)
+	http.HandleFunc("GET /catalogos/{numero}", catalogoHandler)
+	http.HandleFunc("GET /ubigeos/{codigo}", ubigeoHandler)
+	http.HandleFunc("GET /comprobantes/{ruc}/{tipo}/{serie}/{numero}/estado", estadoComprobanteHandler(clientes))
+	http.HandleFunc("POST /comprobantes/{ruc}/{tipo}/{serie}/{numero}/cdr", recuperarCDRHandler(clientes))
+	http.HandleFunc("GET /comprobantes/{ruc}/{tipo}/{serie}/{numero}/intercambios", intercambiosHandler(clientes))
+	http.HandleFunc("POST /comprobantes/validez", validezHandler(clientes))
+	http.HandleFunc("POST /lotes", enviarLoteHandler(clientes, firmas))
+	http.HandleFunc("GET /lotes/{ruc}/{ticket}", ticketLoteHandler(clientes))
+	http.HandleFunc("GET /sunat/colas", colasHandler(clientes))
 
 	log.Println("Servidor iniciado. Escuchando en http://localhost:8080")
 	log.Println("Endpoint disponible en: POST /convertir")
+	log.Println("Endpoint disponible en: GET /catalogos y GET /catalogos/{numero}")
+	log.Println("Endpoint disponible en: GET /ubigeos/{codigo}")
+	log.Println("Endpoint disponible en: GET /comprobantes/{ruc}/{tipo}/{serie}/{numero}/estado y POST .../cdr")
+	log.Println("Endpoint disponible en: GET /comprobantes/{ruc}/{tipo}/{serie}/{numero}/intercambios")
+	log.Println("Endpoint disponible en: POST /comprobantes/validez")
+	log.Println("Endpoint disponible en: POST /lotes y GET /lotes/{ruc}/{ticket}")
+	log.Println("Endpoint disponible en: GET /sunat/colas")
+
+	// Al apagar el servidor se cancela el contexto de todas las peticiones, y con él las
+	// llamadas a SUNAT en curso, en lugar de esperar a que venzan sus plazos.
+	ctx, detener := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer detener()
 
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	// Un certificado renovado se toma sin reiniciar: al cambiar sus archivos o con SIGHUP.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go firmas.vigilar(ctx, hup)
+	srv := &http.Server{Addr: ":8080", BaseContext: func(net.Listener) context.Context { return ctx }}
+	apagado := make(chan struct{})
+	go func() {
+		defer close(apagado)
+		<-ctx.Done()
+		log.Println("Apagando el servidor...")
+		plazo, cancelar := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancelar()
+		if err := srv.Shutdown(plazo); err != nil {
+			log.Printf("El servidor no terminó de apagarse: %v", err)
+		}
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Error al iniciar el servidor: %v", err)
 	}
+	<-apagado
 }
@@ -4,11 +4,14 @@ import "github.com/shopspring/decimal"
 
 // DocumentoElectronico define la estructura principal de la entrada JSON.
 type DocumentoElectronico struct {
-	TipoDocumento          string          `json:"tipoDocumento"`
-	Serie                  string          `json:"serie"`
-	Correlativo            string          `json:"correlativo"`
-	FechaEmision           string          `json:"fechaEmision"`
-	Moneda                 string          `json:"moneda"`
+	TipoDocumento string `json:"tipoDocumento"`
+	Serie         string `json:"serie"`
+	Correlativo   string `json:"correlativo"`
+	FechaEmision  string `json:"fechaEmision"`
+	Moneda        string `json:"moneda"`
+	// TipoCambio son los soles por unidad de Moneda (venta SBS del día) cuando el documento no
+	// está en PEN; con él se convierten los topes expresados en soles.
+	TipoCambio             decimal.Decimal `json:"tipoCambio,omitempty"`
 	Emisor                 Empresa         `json:"emisor"`
 	Receptor               Empresa         `json:"receptor"`
 	TotalGravado           decimal.Decimal `json:"totalGravado"`
@@ -29,6 +32,8 @@ type Empresa struct {
 	RazonSocial      string    `json:"razonSocial"`
 	NombreComercial  string    `json:"nombreComercial,omitempty"`
 	Direccion        Direccion `json:"direccion"`
+	// Regimen solo aplica al emisor: "GENERAL" (por defecto) o "MYPE_RESTAURANTE_HOTEL".
+	Regimen string `json:"regimen,omitempty"`
 }
 
 // Direccion define los campos de una dirección fiscal.
@@ -44,8 +49,12 @@ type Direccion struct {
 
 // Detalle define una línea del comprobante.
 type Detalle struct {
-	ID             int             `json:"id"`
-	CodigoProducto string          `json:"codigoProducto"`
+	ID             int    `json:"id"`
+	CodigoProducto string `json:"codigoProducto"`
+	// CodigoProductoSUNAT es el código UNSPSC del catálogo 25 (8 dígitos).
+	CodigoProductoSUNAT string `json:"codigoProductoSunat,omitempty"`
+	// CodigoGTIN es el código de barras GS1 (GTIN-8, 12, 13 o 14).
+	CodigoGTIN     string          `json:"codigoGTIN,omitempty"`
 	Descripcion    string          `json:"descripcion"`
 	UnidadMedida   string          `json:"unidadMedida"`
 	Cantidad       decimal.Decimal `json:"cantidad"`
@@ -54,6 +63,19 @@ type Detalle struct {
 	ValorTotal     decimal.Decimal `json:"valorTotal"`
 	AfectacionIGV  string          `json:"afectacionIGV"`
 	IGV            decimal.Decimal `json:"igv"`
+	// PropiedadesAdicionales lleva los datos sectoriales del catálogo 55 (placa, hospedaje, transporte).
+	PropiedadesAdicionales []PropiedadAdicional `json:"propiedadesAdicionales,omitempty"`
+}
+
+// PropiedadAdicional es un dato adicional del ítem identificado por un código del catálogo 55.
+// Las fechas y la duración (en días) describen el periodo al que aplica, por ejemplo una estadía.
+type PropiedadAdicional struct {
+	Codigo       string `json:"codigo"`
+	Nombre       string `json:"nombre,omitempty"`
+	Valor        string `json:"valor,omitempty"`
+	FechaInicio  string `json:"fechaInicio,omitempty"`
+	FechaFin     string `json:"fechaFin,omitempty"`
+	DuracionDias int    `json:"duracionDias,omitempty"`
 }
 
 // Leyenda define una leyenda del comprobante.
@@ -71,10 +93,59 @@ type RespuestaExito struct {
 	XmlHash       string `json:"xmlHash"`
 	ProcessedAt   string `json:"processedAt"`
 	SunatCDR      string `json:"sunatCdr,omitempty"`
+	// CDR es la constancia ya interpretada; Estado distingue aceptado, observado o rechazado.
+	CDR           *CDR              `json:"cdr,omitempty"`
+	Observaciones []ErrorValidacion `json:"observaciones,omitempty"`
+}
+
+// RespuestaConsulta es la respuesta de los endpoints que consultan un comprobante en SUNAT.
+type RespuestaConsulta struct {
+	Status        string               `json:"status"`
+	CorrelationId string               `json:"correlationId"`
+	DocumentId    string               `json:"documentId"`
+	CdrPath       string               `json:"cdrPath,omitempty"`
+	Consulta      *ConsultaComprobante `json:"consulta"`
+}
+
+// RespuestaIntercambios es la respuesta de GET /comprobantes/.../intercambios.
+type RespuestaIntercambios struct {
+	Status        string        `json:"status"`
+	CorrelationId string        `json:"correlationId"`
+	DocumentId    string        `json:"documentId"`
+	Intercambios  []Intercambio `json:"intercambios"`
+}
+
+// RespuestaColas es la respuesta de GET /sunat/colas.
+type RespuestaColas struct {
+	Status string       `json:"status"`
+	Colas  []EstadoCola `json:"colas"`
+}
+
+// RespuestaValidez es la respuesta de POST /comprobantes/validez.
+type RespuestaValidez struct {
+	Status        string            `json:"status"`
+	CorrelationId string            `json:"correlationId"`
+	Valido        bool              `json:"valido"`
+	Resultado     *ResultadoValidez `json:"resultado"`
+}
+
+// RespuestaLote es la respuesta de POST /lotes.
+type RespuestaLote struct {
+	Status        string   `json:"status"`
+	CorrelationId string   `json:"correlationId"`
+	Lote          string   `json:"lote"`
+	Ticket        string   `json:"ticket"`
+	Documentos    []string `json:"documentos"`
 }
 type RespuestaError struct {
-	Status        string `json:"status"`
-	CorrelationId string `json:"correlationId"`
-	ErrorCode     string `json:"errorCode"`
-	ErrorMessage  string `json:"errorMessage"`
+	Status        string            `json:"status"`
+	CorrelationId string            `json:"correlationId"`
+	ErrorCode     string            `json:"errorCode"`
+	ErrorMessage  string            `json:"errorMessage"`
+	Errores       []ErrorValidacion `json:"errores,omitempty"`
+	// CodigoSunat y Reintentable acompañan a los errores devueltos por SUNAT o el OSE.
+	CodigoSunat  string `json:"codigoSunat,omitempty"`
+	Reintentable bool   `json:"reintentable,omitempty"`
+	// CDR acompaña a ERR_SUNAT_RECHAZO_CDR: SUNAT recibió el comprobante y lo rechazó en la constancia.
+	CDR *CDR `json:"cdr,omitempty"`
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// PlazosOperacion fija cuánto puede durar cada intento de llamada a SUNAT antes de
+// abandonarlo. Cada intento tiene su propio plazo; la espera entre reintentos no cuenta.
+type PlazosOperacion struct {
+	// EnvioMs acota sendBill y sendPack, que suben el ZIP y esperan la respuesta.
+	EnvioMs int `json:"envioMs"`
+	// ConsultaMs acota getStatus, getStatusCdr y las API REST.
+	ConsultaMs int `json:"consultaMs"`
+}
+
+var plazosPorDefecto = PlazosOperacion{EnvioMs: 30000, ConsultaMs: 10000}
+
+// completar reemplaza los valores no configurados por los plazos por defecto.
+func (p PlazosOperacion) completar() PlazosOperacion {
+	if p.EnvioMs <= 0 {
+		p.EnvioMs = plazosPorDefecto.EnvioMs
+	}
+	if p.ConsultaMs <= 0 {
+		p.ConsultaMs = plazosPorDefecto.ConsultaMs
+	}
+	return p
+}
+
+// para devuelve el plazo de la operación SOAP indicada.
+func (p PlazosOperacion) para(operacion string) time.Duration {
+	switch operacion {
+	case "sendBill", "sendPack", "sendSummary":
+		return time.Duration(p.EnvioMs) * time.Millisecond
+	}
+	return time.Duration(p.ConsultaMs) * time.Millisecond
+}
+
+// cabeceraCorrelacion viaja en cada petición a SUNAT (o al OSE) para poder cruzar sus
+// registros con nuestro log.
+const cabeceraCorrelacion = "X-Correlation-ID"
+
+type claveCorrelacion struct{}
+
+// conCorrelacion devuelve un contexto que lleva el correlation ID de la petición.
+func conCorrelacion(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, claveCorrelacion{}, id)
+}
+
+// correlacionDe devuelve el correlation ID del contexto, o "" si no tiene.
+func correlacionDe(ctx context.Context) string {
+	id, _ := ctx.Value(claveCorrelacion{}).(string)
+	return id
+}
+
+// esperar duerme d o hasta que se cancele ctx, lo que ocurra primero.
+func esperar(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPlazosOperacion(t *testing.T) {
+	p := PlazosOperacion{ConsultaMs: 500}.completar()
+	if p.EnvioMs != plazosPorDefecto.EnvioMs || p.ConsultaMs != 500 {
+		t.Errorf("completar() = %+v", p)
+	}
+	if p := (PlazosOperacion{EnvioMs: -1}).completar(); p != plazosPorDefecto {
+		t.Errorf("los plazos no positivos deben tomar el valor por defecto: %+v", p)
+	}
+
+	casos := []struct {
+		operacion string
+		plazo     time.Duration
+	}{
+		{"sendBill", 30 * time.Second},
+		{"sendPack", 30 * time.Second},
+		{"sendSummary", 30 * time.Second},
+		{"getStatus", 500 * time.Millisecond},
+		{"getStatusCdr", 500 * time.Millisecond},
+	}
+	for _, c := range casos {
+		if got := p.para(c.operacion); got != c.plazo {
+			t.Errorf("para(%q) = %v, se esperaba %v", c.operacion, got, c.plazo)
+		}
+	}
+}
+
+func TestCorrelacion(t *testing.T) {
+	if got := correlacionDe(context.Background()); got != "" {
+		t.Errorf("contexto sin correlation ID: %q", got)
+	}
+	ctx := conCorrelacion(context.Background(), "abc-123")
+	if got := correlacionDe(ctx); got != "abc-123" {
+		t.Errorf("correlacionDe = %q", got)
+	}
+	// El ID sobrevive a los contextos derivados, como el del plazo de cada intento.
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if got := correlacionDe(ctx); got != "abc-123" {
+		t.Errorf("correlacionDe en un contexto derivado = %q", got)
+	}
+}
+
+func TestEsperar(t *testing.T) {
+	if err := esperar(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("esperar sin cancelación: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	inicio := time.Now()
+	err := esperar(ctx, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("esperar cancelado = %v, se esperaba context.Canceled", err)
+	}
+	if d := time.Since(inicio); d > 5*time.Second {
+		t.Errorf("esperar no se interrumpió al cancelar el contexto (%v)", d)
+	}
+}
+
+func TestLlamarSOAPPlazo(t *testing.T) {
+	correlaciones := make(chan string, 1)
+	fin := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlaciones <- r.Header.Get(cabeceraCorrelacion)
+		<-fin
+	}))
+	defer srv.Close()
+	defer close(fin)
+
+	c := clientePrueba(srv.URL)
+	c.Plazos = PlazosOperacion{EnvioMs: 60000, ConsultaMs: 50}
+	ctx := conCorrelacion(context.Background(), "req-45")
+
+	inicio := time.Now()
+	_, err := c.llamarSOAP(ctx, "getStatusCdr", "F001-1", srv.URL, []byte("<sobre/>"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("llamarSOAP = %v, se esperaba context.DeadlineExceeded", err)
+	}
+	if d := time.Since(inicio); d > 3*time.Second {
+		t.Errorf("el plazo de consulta de 50 ms no se respetó (%v)", d)
+	}
+	if got := <-correlaciones; got != "req-45" {
+		t.Errorf("cabecera %s = %q, se esperaba req-45", cabeceraCorrelacion, got)
+	}
+	if !esTransitorio(err) {
+		t.Errorf("un plazo vencido debe poder reintentarse: %v", err)
+	}
+}
+
+func TestLlamarSOAPCancelado(t *testing.T) {
+	fin := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-fin
+	}))
+	defer srv.Close()
+	defer close(fin)
+
+	c := clientePrueba(srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := c.llamarSOAP(ctx, "sendBill", "F001-1", srv.URL, []byte("<sobre/>")); !errors.Is(err, context.Canceled) {
+		t.Errorf("llamarSOAP con el contexto cancelado = %v, se esperaba context.Canceled", err)
+	}
+}
@@ -1,32 +1,31 @@
 package main
 
 import (
-	"crypto"
-	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/hex"
-	"encoding/pem"
 	"fmt"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/beevik/etree"
-	dsig "github.com/russellhaering/goxmldsig"
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/transform"
-)
 
-const (
-	keyFilePath  = "./certs/private_pkcs8.key"
-	certFilePath = "./certs/public.pem"
+	"mi-conversor-ubl/catalogos"
 )
 
-// ProcesarDocumento orquesta la creación, firma y codificación.
-func ProcesarDocumento(docIn *DocumentoElectronico) ([]byte, error) {
+// ProcesarDocumento orquesta la creación, firma y codificación. Firma con el certificado
+// del emisor del documento; si no puede usarse devuelve *ErrorFirma.
+func ProcesarDocumento(docIn *DocumentoElectronico, almacen *AlmacenFirmas) ([]byte, error) {
+	firma, err := almacen.firmaPara(docIn.Emisor.RUC, time.Now())
+	if err != nil {
+		return nil, err
+	}
 	xmlDoc := buildXML(docIn)
-	signedDoc, err := firmarXML(xmlDoc, keyFilePath, certFilePath)
+	if err := validarEsquema(xmlDoc); err != nil {
+		return nil, fmt.Errorf("el XML generado no cumple el esquema UBL 2.1: %w", err)
+	}
+	signedDoc, err := firmarXML(xmlDoc, firma)
 	if err != nil {
 		return nil, fmt.Errorf("error al firmar documento: %w", err)
 	}
@@ -46,36 +45,9 @@ func ProcesarDocumento(docIn *DocumentoElectronico) ([]byte, error) {
 }
 
 // firmarXML usa la librería goxmldsig con la configuración correcta y mueve el nodo.
-func firmarXML(doc *etree.Document, keyFile, certFile string) (*etree.Document, error) {
-	keyData, err := os.ReadFile(keyFile)
-	if err != nil {
-		return nil, err
-	}
-	block, _ := pem.Decode(keyData)
-	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
-	if err != nil {
-		return nil, err
-	}
-	rsaPrivateKey := key.(*rsa.PrivateKey)
-
-	certData, err := os.ReadFile(certFile)
-	if err != nil {
-		return nil, err
-	}
-	block, _ = pem.Decode(certData)
-	certificate, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return nil, err
-	}
-
-	certChain := [][]byte{certificate.Raw}
-	ctx, err := dsig.NewSigningContext(rsaPrivateKey, certChain)
-	if err != nil {
-		return nil, err
-	}
-
-	ctx.Canonicalizer = dsig.MakeC14N10RecCanonicalizer()
-	ctx.Hash = crypto.SHA1
+// El contexto de firma ya viene armado: no se relee el certificado en cada comprobante.
+func firmarXML(doc *etree.Document, firma *firmaCargada) (*etree.Document, error) {
+	ctx := firma.contexto
 
 	// Preparamos el nodo Signature con el ID correcto ANTES de firmar.
 	signaturePlaceholder := doc.FindElement("//ds:Signature")
@@ -232,7 +204,7 @@ func buildXML(d *DocumentoElectronico) *etree.Document {
 		itsa2.CreateAttr("currencyID", d.Moneda)
 		itsa2.SetText(item.IGV.StringFixed(2))
 		itc_det := its.CreateElement("cac:TaxCategory")
-		itc_det.CreateElement("cbc:Percent").SetText("18.00")
+		itc_det.CreateElement("cbc:Percent").SetText(tasaIGVLinea(d, item).Shift(2).StringFixed(2))
 		terc := itc_det.CreateElement("cbc:TaxExemptionReasonCode")
 		terc.CreateAttr("listAgencyName", "PE:SUNAT")
 		terc.CreateAttr("listName", "Afectacion del IGV")
@@ -247,6 +219,7 @@ func buildXML(d *DocumentoElectronico) *etree.Document {
 		itsch.CreateElement("cbc:TaxTypeCode").SetText("VAT")
 		iitem := il.CreateElement("cac:Item")
 		iitem.CreateElement("cbc:Description").SetText(item.Descripcion)
+		buildItemIdentificacion(iitem, item)
 		iprice := il.CreateElement("cac:Price")
 		ipa := iprice.CreateElement("cbc:PriceAmount")
 		ipa.CreateAttr("currencyID", d.Moneda)
@@ -255,7 +228,7 @@ func buildXML(d *DocumentoElectronico) *etree.Document {
 	return doc
 }
 
-// --- Funciones de ayuda (addNamespaces, buildParty, calcularHash) ---
+// --- Funciones de ayuda (addNamespaces, buildParty, crearSiNoVacio, calcularHash) ---
 
 func addNamespaces(root *etree.Element) {
 	root.CreateAttr("xmlns", "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2")
@@ -274,11 +247,6 @@ func buildParty(root *etree.Element, partyType string, data Empresa) {
 	p := root.CreateElement(partyType)
 	party := p.CreateElement("cac:Party")
 
-	if data.NombreComercial != "" {
-		pn := party.CreateElement("cac:PartyName")
-		pn.CreateElement("cbc:Name").SetText(data.NombreComercial)
-	}
-
 	pi := party.CreateElement("cac:PartyIdentification")
 	id := pi.CreateElement("cbc:ID")
 	id.CreateAttr("schemeID", data.TipoDocIdentidad)
@@ -287,19 +255,104 @@ func buildParty(root *etree.Element, partyType string, data Empresa) {
 	id.CreateAttr("schemeURI", "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo06")
 	id.SetText(data.RUC)
 
+	// UBL 2.1 exige PartyIdentification antes de PartyName.
+	if data.NombreComercial != "" {
+		pn := party.CreateElement("cac:PartyName")
+		pn.CreateElement("cbc:Name").SetText(data.NombreComercial)
+	}
+
 	ple := party.CreateElement("cac:PartyLegalEntity")
 	ple.CreateElement("cbc:RegistrationName").SetText(data.RazonSocial)
 
 	addr := ple.CreateElement("cac:RegistrationAddress")
-	addr.CreateElement("cbc:AddressTypeCode").SetText(data.Direccion.CodLocal)
-	addr.CreateElement("cbc:CitySubdivisionName").SetText("-")
-	addr.CreateElement("cbc:CityName").SetText(data.Direccion.Provincia)
-	addr.CreateElement("cbc:CountrySubentity").SetText(data.Direccion.Departamento)
-	addr.CreateElement("cbc:District").SetText(data.Direccion.Distrito)
-	al := addr.CreateElement("cac:AddressLine")
-	al.CreateElement("cbc:Line").SetText(data.Direccion.Direccion)
+	if data.Direccion.Ubigeo != "" {
+		ubigeo := addr.CreateElement("cbc:ID")
+		ubigeo.CreateAttr("schemeName", "Ubigeos")
+		ubigeo.CreateAttr("schemeAgencyName", "PE:INEI")
+		ubigeo.SetText(data.Direccion.Ubigeo)
+	}
+	if data.Direccion.CodLocal != "" {
+		atc := addr.CreateElement("cbc:AddressTypeCode")
+		atc.CreateAttr("listAgencyName", "PE:SUNAT")
+		atc.CreateAttr("listName", "Establecimientos anexos")
+		atc.SetText(data.Direccion.CodLocal)
+	}
+	crearSiNoVacio(addr, "cbc:CitySubdivisionName", data.Direccion.Urbanizacion)
+	crearSiNoVacio(addr, "cbc:CityName", data.Direccion.Provincia)
+	crearSiNoVacio(addr, "cbc:CountrySubentity", data.Direccion.Departamento)
+	crearSiNoVacio(addr, "cbc:District", data.Direccion.Distrito)
+	if data.Direccion.Direccion != "" {
+		al := addr.CreateElement("cac:AddressLine")
+		al.CreateElement("cbc:Line").SetText(data.Direccion.Direccion)
+	}
 	country := addr.CreateElement("cac:Country")
-	country.CreateElement("cbc:IdentificationCode").SetText("PE")
+	cic := country.CreateElement("cbc:IdentificationCode")
+	cic.CreateAttr("listID", "ISO 3166-1")
+	cic.CreateAttr("listAgencyName", "United Nations Economic Commission for Europe")
+	cic.CreateAttr("listName", "Country")
+	cic.SetText("PE")
+}
+
+// buildItemIdentificacion agrega el código interno, el GTIN y la clasificación UNSPSC del ítem,
+// en el orden que exige el tipo Item de UBL 2.1.
+func buildItemIdentificacion(iitem *etree.Element, item Detalle) {
+	if item.CodigoProducto != "" {
+		sii := iitem.CreateElement("cac:SellersItemIdentification")
+		sii.CreateElement("cbc:ID").SetText(item.CodigoProducto)
+	}
+	if item.CodigoGTIN != "" {
+		std := iitem.CreateElement("cac:StandardItemIdentification")
+		stdID := std.CreateElement("cbc:ID")
+		stdID.CreateAttr("schemeID", fmt.Sprintf("GTIN-%d", len(item.CodigoGTIN)))
+		stdID.SetText(item.CodigoGTIN)
+	}
+	if item.CodigoProductoSUNAT != "" {
+		cc := iitem.CreateElement("cac:CommodityClassification")
+		icc := cc.CreateElement("cbc:ItemClassificationCode")
+		icc.CreateAttr("listID", "UNSPSC")
+		icc.CreateAttr("listAgencyName", "GS1 US")
+		icc.CreateAttr("listName", "Item Classification")
+		icc.SetText(item.CodigoProductoSUNAT)
+	}
+	for _, prop := range item.PropiedadesAdicionales {
+		buildPropiedadAdicional(iitem, prop)
+	}
+}
+
+// buildPropiedadAdicional emite una cac:AdditionalItemProperty; si no se envía nombre se usa
+// la descripción oficial del catálogo 55.
+func buildPropiedadAdicional(iitem *etree.Element, prop PropiedadAdicional) {
+	aip := iitem.CreateElement("cac:AdditionalItemProperty")
+	nombre := prop.Nombre
+	if nombre == "" {
+		nombre = catalogos.Descripcion(catalogos.PropiedadItem, prop.Codigo)
+	}
+	aip.CreateElement("cbc:Name").SetText(nombre)
+	nc := aip.CreateElement("cbc:NameCode")
+	nc.CreateAttr("listAgencyName", "PE:SUNAT")
+	nc.CreateAttr("listName", "Propiedad del item")
+	nc.CreateAttr("listURI", "urn:pe:gob:sunat:cpe:see:gem:catalogos:catalogo55")
+	nc.SetText(prop.Codigo)
+	crearSiNoVacio(aip, "cbc:Value", prop.Valor)
+
+	if prop.FechaInicio == "" && prop.FechaFin == "" && prop.DuracionDias == 0 {
+		return
+	}
+	up := aip.CreateElement("cac:UsabilityPeriod")
+	crearSiNoVacio(up, "cbc:StartDate", prop.FechaInicio)
+	crearSiNoVacio(up, "cbc:EndDate", prop.FechaFin)
+	if prop.DuracionDias > 0 {
+		dm := up.CreateElement("cbc:DurationMeasure")
+		dm.CreateAttr("unitCode", "DAY")
+		dm.SetText(strconv.Itoa(prop.DuracionDias))
+	}
+}
+
+// crearSiNoVacio agrega el elemento solo si hay texto: SUNAT rechaza tags vacíos.
+func crearSiNoVacio(parent *etree.Element, tag, texto string) {
+	if texto != "" {
+		parent.CreateElement(tag).SetText(texto)
+	}
 }
 
 func calcularHash(data []byte) string {
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// PoliticaReintentos controla cuántas veces se repite una llamada a SUNAT que falló por un
+// problema transitorio y cuánto se espera entre intentos (backoff exponencial con jitter).
+type PoliticaReintentos struct {
+	// Intentos es el total de intentos, incluido el primero. 1 desactiva los reintentos.
+	Intentos int `json:"intentos"`
+	// EsperaInicialMs es la espera máxima antes del primer reintento; se duplica en cada uno.
+	EsperaInicialMs int `json:"esperaInicialMs"`
+	// EsperaMaximaMs acota la espera entre dos intentos.
+	EsperaMaximaMs int `json:"esperaMaximaMs"`
+}
+
+var politicaReintentosPorDefecto = PoliticaReintentos{Intentos: 3, EsperaInicialMs: 1000, EsperaMaximaMs: 10000}
+
+// completar reemplaza los valores no configurados por los de la política por defecto.
+func (p PoliticaReintentos) completar() PoliticaReintentos {
+	if p.Intentos <= 0 {
+		p.Intentos = politicaReintentosPorDefecto.Intentos
+	}
+	if p.EsperaInicialMs <= 0 {
+		p.EsperaInicialMs = politicaReintentosPorDefecto.EsperaInicialMs
+	}
+	if p.EsperaMaximaMs < p.EsperaInicialMs {
+		p.EsperaMaximaMs = max(p.EsperaInicialMs, politicaReintentosPorDefecto.EsperaMaximaMs)
+	}
+	return p
+}
+
+// espera devuelve cuánto esperar antes del reintento n (1, 2, ...). Se usa "full jitter":
+// un valor al azar entre 0 y el tope exponencial, para que varios envíos que fallaron a la
+// vez no vuelvan a golpear a SUNAT en el mismo instante.
+func (p PoliticaReintentos) espera(n int) time.Duration {
+	tope := time.Duration(p.EsperaMaximaMs) * time.Millisecond
+	base := time.Duration(p.EsperaInicialMs) * time.Millisecond
+	for i := 1; i < n && base < tope; i++ {
+		base *= 2
+	}
+	base = min(base, tope)
+	return time.Duration(rand.Int64N(int64(base) + 1))
+}
+
+// errorHTTP es una respuesta de SUNAT con estado distinto de 200 que no trae un SOAP fault.
+type errorHTTP struct {
+	Estado int
+	Cuerpo string
+}
+
+func (e *errorHTTP) Error() string {
+	return fmt.Sprintf("SUNAT respondió con estado HTTP %d: %s", e.Estado, e.Cuerpo)
+}
+
+// esTransitorio indica si vale la pena repetir la llamada: fallas de red y timeouts,
+// errores 5xx, 408 y 429, y las excepciones de SUNAT marcadas como reintentables.
+func esTransitorio(err error) bool {
+	var errSunat *ErrorSUNAT
+	if errors.As(err, &errSunat) {
+		return errSunat.Reintentable
+	}
+	var errHTTP *errorHTTP
+	if errors.As(err, &errHTTP) {
+		return errHTTP.Estado >= 500 || errHTTP.Estado == http.StatusRequestTimeout || errHTTP.Estado == http.StatusTooManyRequests
+	}
+	var errRed net.Error
+	return errors.As(err, &errRed) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+var regexOperacionSOAP = regexp.MustCompile(`<ser:(\w+)>`)
+
+// servidorSUNAT simula billService y billConsultService: responder recibe la operación del
+// sobre ("sendBill", "getStatusCdr", ...) y devuelve el estado HTTP y el cuerpo. llamadas
+// cuenta las peticiones de cada operación.
+type servidorSUNAT struct {
+	*httptest.Server
+	mu       sync.Mutex
+	llamadas map[string]int
+}
+
+func nuevoServidorSUNAT(t *testing.T, responder func(operacion string, llamada int) (int, string)) *servidorSUNAT {
+	t.Helper()
+	s := &servidorSUNAT{llamadas: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cuerpo, _ := io.ReadAll(r.Body)
+		operacion := ""
+		if m := regexOperacionSOAP.FindSubmatch(cuerpo); m != nil {
+			operacion = string(m[1])
+		}
+		s.mu.Lock()
+		s.llamadas[operacion]++
+		n := s.llamadas[operacion]
+		s.mu.Unlock()
+		estado, respuesta := responder(operacion, n)
+		w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+		w.WriteHeader(estado)
+		io.WriteString(w, respuesta)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *servidorSUNAT) llamadasA(operacion string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.llamadas[operacion]
+}
+
+// clientePrueba apunta billService y billConsultService al servidor de prueba, con esperas
+// de milisegundos entre reintentos.
+func clientePrueba(url string) *Client {
+	c := NewClient(Entorno{Nombre: "prueba", URLFacturas: url, URLConsulta: url}, "20100066603", CredencialesSOL{Usuario: "MODDATOS", Clave: "moddatos"})
+	c.Reintentos = PoliticaReintentos{Intentos: 3, EsperaInicialMs: 1, EsperaMaximaMs: 2}
+	return c
+}
+
+// sobreRespuesta envuelve el nodo de respuesta de una operación en un sobre SOAP.
+func sobreRespuesta(cuerpo string) string {
+	return `<soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/"><soap-env:Body>` + cuerpo + `</soap-env:Body></soap-env:Envelope>`
+}
+
+// respuestaSendBill devuelve el CDR dentro de un ZIP en Base64, como lo hace sendBill.
+func respuestaSendBill(t *testing.T, cdr []byte) string {
+	t.Helper()
+	zipData, err := crearZip("R-20100066603-01-F001-1.xml", cdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sobreRespuesta(`<br:sendBillResponse xmlns:br="http://service.sunat.gob.pe"><applicationResponse>` + base64.StdEncoding.EncodeToString(zipData) + `</applicationResponse></br:sendBillResponse>`)
+}
+
+// respuestaSinCDR es la respuesta de getStatusCdr cuando SUNAT no tiene el comprobante.
+var respuestaSinCDR = sobreRespuesta(`<br:getStatusCdrResponse xmlns:br="http://service.sunat.gob.pe"><statusCdr><statusCode>0127</statusCode><statusMessage>El comprobante no existe</statusMessage></statusCdr></br:getStatusCdrResponse>`)
+
+func TestEsperaReintento(t *testing.T) {
+	p := PoliticaReintentos{Intentos: 5, EsperaInicialMs: 100, EsperaMaximaMs: 250}
+	topes := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond, 250 * time.Millisecond}
+	for i := 0; i < 200; i++ {
+		for n, tope := range topes {
+			if e := p.espera(n + 1); e < 0 || e > tope {
+				t.Fatalf("espera(%d) = %s, fuera de [0, %s]", n+1, e, tope)
+			}
+		}
+	}
+}
+
+func TestCompletarPoliticaReintentos(t *testing.T) {
+	if p := (PoliticaReintentos{}).completar(); p != politicaReintentosPorDefecto {
+		t.Errorf("política vacía completada como %+v", p)
+	}
+	p := PoliticaReintentos{Intentos: 1, EsperaInicialMs: 20000, EsperaMaximaMs: 5}.completar()
+	if p.Intentos != 1 || p.EsperaMaximaMs != 20000 {
+		t.Errorf("se obtuvo %+v, se esperaba 1 intento y espera máxima de 20000 ms", p)
+	}
+}
+
+func TestEsTransitorio(t *testing.T) {
+	casos := []struct {
+		nombre      string
+		err         error
+		transitorio bool
+	}{
+		{"excepción reintentable", &ErrorSUNAT{Codigo: "0109", Reintentable: true}, true},
+		{"rechazo", &ErrorSUNAT{Codigo: "2800"}, false},
+		{"envuelto", fmt.Errorf("envío: %w", &ErrorSUNAT{Codigo: "0138", Reintentable: true}), true},
+		{"HTTP 503", &errorHTTP{Estado: http.StatusServiceUnavailable}, true},
+		{"HTTP 408", &errorHTTP{Estado: http.StatusRequestTimeout}, true},
+		{"HTTP 429", &errorHTTP{Estado: http.StatusTooManyRequests}, true},
+		{"HTTP 400", &errorHTTP{Estado: http.StatusBadRequest}, false},
+		{"red", fmt.Errorf("error al enviar la petición a SUNAT: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), true},
+		{"respuesta cortada", fmt.Errorf("error al leer la respuesta de SUNAT: %w", io.ErrUnexpectedEOF), true},
+		{"otro", errors.New("XML de respuesta SOAP mal formado"), false},
+	}
+	for _, c := range casos {
+		if got := esTransitorio(c.err); got != c.transitorio {
+			t.Errorf("%s: esTransitorio = %t, se esperaba %t", c.nombre, got, c.transitorio)
+		}
+	}
+}
+
+func TestEnviarConReintentos(t *testing.T) {
+	faultRechazo := string(faultPrueba("soap-env:Client.2800", "2800"))
+	casos := []struct {
+		nombre string
+		// sendBill y getStatusCdr responden según el número de llamada (1, 2, ...).
+		sendBill, getStatusCdr func(n int) (int, string)
+		envios, consultas      int
+		error                  bool
+	}{
+		{
+			nombre: "se recupera al tercer intento",
+			sendBill: func(n int) (int, string) {
+				if n < 3 {
+					return http.StatusServiceUnavailable, "Service Unavailable"
+				}
+				return http.StatusOK, respuestaSendBill(t, cdrPrueba("0"))
+			},
+			getStatusCdr: func(int) (int, string) { return http.StatusOK, respuestaSinCDR },
+			envios:       3, consultas: 2,
+		},
+		{
+			nombre:   "rechazo definitivo sin reintentar",
+			sendBill: func(int) (int, string) { return http.StatusInternalServerError, faultRechazo },
+			envios:   1, error: true,
+		},
+		{
+			nombre:       "reintentos agotados",
+			sendBill:     func(int) (int, string) { return http.StatusBadGateway, "Bad Gateway" },
+			getStatusCdr: func(int) (int, string) { return http.StatusOK, respuestaSinCDR },
+			envios:       3, consultas: 2, error: true,
+		},
+		{
+			nombre:   "el primer envío llegó",
+			sendBill: func(int) (int, string) { return http.StatusGatewayTimeout, "Gateway Timeout" },
+			getStatusCdr: func(int) (int, string) {
+				zipData, _ := crearZip("R-20100066603-01-F001-1.xml", cdrPrueba("0"))
+				return http.StatusOK, sobreRespuesta(`<br:getStatusCdrResponse xmlns:br="http://service.sunat.gob.pe"><statusCdr><statusCode>0004</statusCode><statusMessage>La constancia existe</statusMessage><content>` + base64.StdEncoding.EncodeToString(zipData) + `</content></statusCdr></br:getStatusCdrResponse>`)
+			},
+			envios: 1, consultas: 1,
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			s := nuevoServidorSUNAT(t, func(operacion string, n int) (int, string) {
+				switch {
+				case operacion == "sendBill":
+					return c.sendBill(n)
+				case operacion == "getStatusCdr" && c.getStatusCdr != nil:
+					return c.getStatusCdr(n)
+				}
+				return http.StatusNotFound, ""
+			})
+			cdr, err := clientePrueba(s.URL).enviarConReintentos(context.Background(), "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", construirSOAPRequest("20100066603-01-F001-1.zip", []byte("PK"), "MODDATOS", "moddatos"))
+			if (err != nil) != c.error {
+				t.Fatalf("error %v, se esperaba error %t", err, c.error)
+			}
+			if err == nil && cdr.Estado != CDRAceptado {
+				t.Errorf("CDR %+v", cdr)
+			}
+			if s.llamadasA("sendBill") != c.envios || s.llamadasA("getStatusCdr") != c.consultas {
+				t.Errorf("%d envíos y %d consultas, se esperaban %d y %d", s.llamadasA("sendBill"), s.llamadasA("getStatusCdr"), c.envios, c.consultas)
+			}
+		})
+	}
+}
+
+func TestEnviarConReintentosCancelado(t *testing.T) {
+	s := nuevoServidorSUNAT(t, func(string, int) (int, string) { return http.StatusServiceUnavailable, "" })
+	c := clientePrueba(s.URL)
+	c.Reintentos = PoliticaReintentos{Intentos: 5, EsperaInicialMs: 60000, EsperaMaximaMs: 60000}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	inicio := time.Now()
+	_, err := c.enviarConReintentos(ctx, "20100066603-01-F001-1.zip", "20100066603-01-F001-1.xml", construirSOAPRequest("20100066603-01-F001-1.zip", []byte("PK"), "MODDATOS", "moddatos"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("se obtuvo %v, se esperaba context.DeadlineExceeded", err)
+	}
+	if time.Since(inicio) > 5*time.Second {
+		t.Errorf("la cancelación no cortó la espera entre reintentos")
+	}
+}
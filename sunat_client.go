@@ -3,10 +3,15 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 
@@ -16,76 +21,216 @@ import (
 // Client encapsula la configuración y la lógica para comunicarse con SUNAT.
 type Client struct {
 	httpClient *http.Client
+	Entorno    Entorno
 	URL        string
 	Username   string
-	Password   string
+	Password   secreto
+	Reintentos PoliticaReintentos
+	// Plazos acota cada intento; la cancelación del contexto del llamador corta antes.
+	Plazos PlazosOperacion
+	RUC    string
+	// API son las credenciales OAuth2 de las API REST de SUNAT; token las cachea.
+	API   CredencialesAPI
+	token tokenOAuth
+	// confianzaCDR son los certificados aceptados en la firma de los CDR.
+	confianzaCDR []*x509.Certificate
+	// intercambios archiva cada llamada SOAP; si es nil no se archiva nada.
+	intercambios *archivoIntercambios
+	// limites reparte los turnos hacia cada endpoint; si es nil no hay límite.
+	limites *limitadores
 }
 
-// NewClient crea una nueva instancia del cliente de SUNAT.
+// NewClient crea una nueva instancia del cliente de SUNAT para el entorno indicado.
 // Las credenciales se configuran una sola vez aquí.
-func NewClient(ruc, userSOL, passSOL string) *Client {
-	// Para el billService en beta, la contraseña es el RUC.
-	password := ruc
+func NewClient(entorno Entorno, ruc string, cred CredencialesSOL) *Client {
+	username := cred.Usuario
+	if entorno.UsuarioConRUC {
+		username = ruc + cred.Usuario
+	}
 
 	return &Client{
-		httpClient: &http.Client{Timeout: 30 * time.Second},
-		URL:        "https://e-beta.sunat.gob.pe/ol-ti-itcpfegem-beta/billService",
-		Username:   ruc + userSOL,
-		Password:   password,
+		// Sin Timeout global: cada llamada lleva el plazo de su operación en el contexto.
+		httpClient: &http.Client{},
+		Entorno:    entorno,
+		URL:        entorno.URLFacturas,
+		Username:   username,
+		Password:   cred.Clave,
+		Reintentos: politicaReintentosPorDefecto,
+		Plazos:     plazosPorDefecto,
+		RUC:        ruc,
 	}
 }
 
 // EnviarFactura toma los datos del documento y realiza todo el proceso.
-func (c *Client) EnviarFactura(nombreArchivoZIP, nombreArchivoXML string, xmlFirmado []byte) (string, error) {
+//
+// Las fallas transitorias se reintentan según c.Reintentos. Como SUNAT pudo haber recibido
+// el comprobante aunque la respuesta no llegara, antes de cada reintento se consulta su CDR:
+// si ya existe se devuelve ese, y así un timeout nunca termina en un error 1033.
+//
+// Si ctx se cancela (el cliente HTTP se desconectó o el servidor se está apagando) la
+// llamada en curso se corta y no se reintenta; el CDR puede recuperarse luego con ConsultarCDR.
+func (c *Client) EnviarFactura(ctx context.Context, nombreArchivoZIP, nombreArchivoXML string, xmlFirmado []byte) (*CDR, error) {
 	// 1. Crear el ZIP
 	zipData, err := crearZip(nombreArchivoXML, xmlFirmado)
 	if err != nil {
-		return "", fmt.Errorf("error al crear el archivo ZIP: %w", err)
+		return nil, fmt.Errorf("error al crear el archivo ZIP: %w", err)
 	}
 
 	// 2. Construir el sobre SOAP con las credenciales del cliente
-	soapRequest := construirSOAPRequest(nombreArchivoZIP, zipData, c.Username, c.Password)
+	soapRequest := construirSOAPRequest(nombreArchivoZIP, zipData, c.Username, string(c.Password))
+
+	// 3. Enviar, reintentando solo las fallas transitorias
+	cdr, err := c.enviarConReintentos(ctx, nombreArchivoZIP, nombreArchivoXML, soapRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	// 5. Verificar que el CDR sea de SUNAT y de este documento
+	_, _, serie, numero, _ := partesNombreArchivo(nombreArchivoXML)
+	if err := c.verificarCDR(cdr, serie+"-"+numero, xmlFirmado); err != nil {
+		return nil, err
+	}
+	return cdr, nil
+}
+
+func (c *Client) enviarConReintentos(ctx context.Context, nombreArchivoZIP, nombreArchivoXML string, soapRequest []byte) (*CDR, error) {
+	for intento := 1; ; intento++ {
+		if intento > 1 {
+			if cdr, ok := c.cdrRegistrado(ctx, nombreArchivoXML); ok {
+				return cdr, nil
+			}
+		}
+
+		respBody, err := c.llamarSOAP(ctx, "sendBill", strings.TrimSuffix(nombreArchivoXML, ".xml"), c.URL, soapRequest)
+		if err == nil {
+			// 4. Procesar la respuesta
+			return procesarRespuestaSUNAT(respBody)
+		}
+
+		// Un 1033 tras un intento fallido significa que el primer envío sí llegó.
+		var errSunat *ErrorSUNAT
+		if intento > 1 && errors.As(err, &errSunat) && errSunat.YaRegistrado() {
+			if cdr, ok := c.cdrRegistrado(ctx, nombreArchivoXML); ok {
+				return cdr, nil
+			}
+		}
+		if ctx.Err() != nil || !esTransitorio(err) || intento >= c.Reintentos.Intentos {
+			return nil, err
+		}
 
-	// 3. Realizar la petición HTTP
-	req, err := http.NewRequest("POST", c.URL, bytes.NewBuffer(soapRequest))
+		espera := c.Reintentos.espera(intento)
+		log.Printf("[%s] Envío de %s falló (intento %d de %d), se reintenta en %s: %v", correlacionDe(ctx), nombreArchivoZIP, intento, c.Reintentos.Intentos, espera.Round(time.Millisecond), err)
+		if err := esperar(ctx, espera); err != nil {
+			return nil, fmt.Errorf("envío de %s cancelado antes de reintentar: %w", nombreArchivoZIP, err)
+		}
+	}
+}
+
+// llamarSOAP hace un POST del sobre y devuelve el cuerpo de la respuesta. Los SOAP fault se
+// devuelven como *ErrorSUNAT y los demás estados HTTP distintos de 200 como *errorHTTP.
+// Cada llamada, haya fallado o no, queda archivada con el documento indicado.
+func (c *Client) llamarSOAP(ctx context.Context, operacion, documento, url string, sobre []byte) ([]byte, error) {
+	// La espera en cola no descuenta del plazo de la operación.
+	liberar, err := c.limites.adquirir(ctx, url)
 	if err != nil {
-		return "", fmt.Errorf("error al crear la petición HTTP: %w", err)
+		return nil, err
+	}
+	defer liberar()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Plazos.para(operacion))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(sobre))
+	if err != nil {
+		return nil, fmt.Errorf("error al crear la petición HTTP: %w", err)
 	}
 	req.Header.Set("Content-Type", "text/xml;charset=UTF-8")
+	if id := correlacionDe(ctx); id != "" {
+		req.Header.Set(cabeceraCorrelacion, id)
+	}
+
+	intercambio := Intercambio{Operacion: operacion, URL: url, Inicio: time.Now(), CabecerasPeticion: req.Header.Clone(), Peticion: string(sobre)}
+	defer func() {
+		intercambio.DuracionMs = time.Since(intercambio.Inicio).Milliseconds()
+		c.intercambios.registrar(documento, intercambio)
+	}()
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error al enviar la petición a SUNAT: %w", err)
+		intercambio.Error = err.Error()
+		return nil, fmt.Errorf("error al enviar la petición a SUNAT: %w", err)
 	}
 	defer resp.Body.Close()
+	intercambio.EstadoHTTP = resp.StatusCode
+	intercambio.Cabeceras = resp.Header
 
 	respBody, err := io.ReadAll(resp.Body)
+	intercambio.Respuesta = string(respBody)
 	if err != nil {
-		return "", fmt.Errorf("error al leer la respuesta de SUNAT: %w", err)
+		intercambio.Error = err.Error()
+		return nil, fmt.Errorf("error al leer la respuesta de SUNAT: %w", err)
 	}
 
-	// 4. Procesar la respuesta
+	if fault := parsearFaultSOAP(respBody, resp.StatusCode); fault != nil {
+		return nil, fault
+	}
 	if resp.StatusCode != http.StatusOK {
-		if strings.Contains(string(respBody), "faultcode") {
-			return "", fmt.Errorf("SUNAT respondió con un error SOAP: %s", respBody)
-		}
-		return "", fmt.Errorf("SUNAT respondió con estado HTTP %d: %s", resp.StatusCode, respBody)
+		return nil, &errorHTTP{Estado: resp.StatusCode, Cuerpo: string(respBody)}
+	}
+	return respBody, nil
+}
+
+// cdrRegistrado consulta si el comprobante del archivo ya tiene CDR. Si la consulta falla se
+// registra y se responde que no, para que el reintento siga su curso.
+func (c *Client) cdrRegistrado(ctx context.Context, nombreArchivoXML string) (*CDR, bool) {
+	ruc, tipo, serie, numero, ok := partesNombreArchivo(nombreArchivoXML)
+	if !ok {
+		return nil, false
+	}
+	consulta, err := c.ConsultarCDR(ctx, ruc, tipo, serie, numero)
+	if err != nil {
+		log.Printf("[%s] No se pudo consultar el CDR de %s antes de reintentar: %v", correlacionDe(ctx), nombreArchivoXML, err)
+		return nil, false
+	}
+	if consulta.CDR == nil {
+		return nil, false
 	}
+	log.Printf("[%s] SUNAT ya había recibido %s; se usa el CDR registrado en lugar de reenviar", correlacionDe(ctx), nombreArchivoXML)
+	return consulta.CDR, true
+}
 
-	return procesarRespuestaSUNAT(respBody)
+// partesNombreArchivo separa "RUC-TT-SERIE-NUMERO.xml" en sus componentes.
+func partesNombreArchivo(nombre string) (ruc, tipo, serie, numero string, ok bool) {
+	partes := strings.Split(strings.TrimSuffix(strings.TrimSuffix(nombre, ".xml"), ".zip"), "-")
+	if len(partes) != 4 {
+		return "", "", "", "", false
+	}
+	return partes[0], partes[1], partes[2], partes[3], true
 }
 
 // --- Funciones de Ayuda (Helpers) ---
 
 func crearZip(nombreArchivo string, xmlData []byte) ([]byte, error) {
+	return crearZipMultiple([]ArchivoZip{{Nombre: nombreArchivo, Datos: xmlData}})
+}
+
+// ArchivoZip es un archivo que se empaqueta en el ZIP de un envío.
+type ArchivoZip struct {
+	Nombre string
+	Datos  []byte
+}
+
+// crearZipMultiple empaqueta varios XML en un solo ZIP, en el orden recibido.
+func crearZipMultiple(archivos []ArchivoZip) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	zipWriter := zip.NewWriter(buf)
-	zipFile, err := zipWriter.Create(nombreArchivo)
-	if err != nil {
-		return nil, err
-	}
-	if _, err := zipFile.Write(xmlData); err != nil {
-		return nil, err
+	for _, a := range archivos {
+		zipFile, err := zipWriter.Create(a.Nombre)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zipFile.Write(a.Datos); err != nil {
+			return nil, err
+		}
 	}
 	if err := zipWriter.Close(); err != nil {
 		return nil, err
@@ -94,53 +239,85 @@ func crearZip(nombreArchivo string, xmlData []byte) ([]byte, error) {
 }
 
 func construirSOAPRequest(nombreZip string, zipData []byte, usuario, password string) []byte {
-	soapTemplate := `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ser="http://service.sunat.gob.pe" xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"><soapenv:Header><wsse:Security><wsse:UsernameToken><wsse:Username>%s</wsse:Username><wsse:Password>%s</wsse:Password></wsse:UsernameToken></wsse:Security></soapenv:Header><soapenv:Body><ser:sendBill><fileName>%s</fileName><contentFile>%s</contentFile></ser:sendBill></soapenv:Body></soapenv:Envelope>`
 	zipBase64 := base64.StdEncoding.EncodeToString(zipData)
-	return []byte(fmt.Sprintf(soapTemplate, usuario, password, nombreZip, zipBase64))
+	return sobreSOAP(usuario, password, fmt.Sprintf(`<ser:sendBill><fileName>%s</fileName><contentFile>%s</contentFile></ser:sendBill>`, nombreZip, zipBase64))
+}
+
+// sobreSOAP arma el sobre con la cabecera WS-Security y la operación indicada en el cuerpo.
+func sobreSOAP(usuario, password, cuerpo string) []byte {
+	soapTemplate := `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ser="http://service.sunat.gob.pe" xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"><soapenv:Header><wsse:Security><wsse:UsernameToken><wsse:Username>%s</wsse:Username><wsse:Password>%s</wsse:Password></wsse:UsernameToken></wsse:Security></soapenv:Header><soapenv:Body>%s</soapenv:Body></soapenv:Envelope>`
+	return []byte(fmt.Sprintf(soapTemplate, usuario, password, cuerpo))
 }
 
-func procesarRespuestaSUNAT(soapResponse []byte) (string, error) {
+func procesarRespuestaSUNAT(soapResponse []byte) (*CDR, error) {
 	doc := etree.NewDocument()
 	if err := doc.ReadFromBytes(soapResponse); err != nil {
-		return "", fmt.Errorf("XML de respuesta SOAP mal formado: %w", err)
-	}
-
-	if fault := doc.FindElement("//faultstring"); fault != nil {
-		return "", fmt.Errorf("SUNAT respondió con un error SOAP: %s", fault.Text())
+		return nil, fmt.Errorf("XML de respuesta SOAP mal formado: %w", err)
 	}
 
 	cdrNode := doc.FindElement("//applicationResponse")
 	if cdrNode == nil {
-		return "", fmt.Errorf("no se encontró el nodo <applicationResponse> en la respuesta. Respuesta completa: %s", string(soapResponse))
+		return nil, fmt.Errorf("no se encontró el nodo <applicationResponse> en la respuesta. Respuesta completa: %s", string(soapResponse))
+	}
+	return leerZipCDR(cdrNode.Text())
+}
+
+// leerZipCDR decodifica el ZIP en Base64 que envuelve al CDR y lo interpreta.
+func leerZipCDR(contenidoBase64 string) (*CDR, error) {
+	cdrs, err := leerZipCDRs(contenidoBase64)
+	if err != nil {
+		return nil, err
 	}
+	return cdrs[0], nil
+}
 
+// leerZipCDRs interpreta todos los CDR de un ZIP en Base64. Un envío individual trae uno;
+// la respuesta de un lote (sendPack) trae uno por comprobante.
+func leerZipCDRs(contenidoBase64 string) ([]*CDR, error) {
 	// El CDR está en Base64, lo decodificamos
-	cdrZipBytes, err := base64.StdEncoding.DecodeString(cdrNode.Text())
+	cdrZipBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(contenidoBase64))
 	if err != nil {
-		return "", fmt.Errorf("no se pudo decodificar el CDR en Base64: %w", err)
+		return nil, fmt.Errorf("no se pudo decodificar el CDR en Base64: %w", err)
 	}
 
 	// El CDR es un ZIP, lo leemos
 	zipReader, err := zip.NewReader(bytes.NewReader(cdrZipBytes), int64(len(cdrZipBytes)))
 	if err != nil {
-		return "", fmt.Errorf("no se pudo leer el ZIP del CDR: %w", err)
+		return nil, fmt.Errorf("no se pudo leer el ZIP del CDR: %w", err)
 	}
 
-	// Buscamos el archivo XML dentro del ZIP
+	// Buscamos los archivos XML dentro del ZIP
+	var cdrs []*CDR
 	for _, file := range zipReader.File {
-		if strings.HasSuffix(strings.ToLower(file.Name), ".xml") {
-			rc, err := file.Open()
-			if err != nil {
-				return "", err
-			}
-			defer rc.Close()
-			cdrContent, err := io.ReadAll(rc)
-			if err != nil {
-				return "", err
-			}
-			return string(cdrContent), nil // ¡Éxito!
+		if !strings.HasSuffix(strings.ToLower(file.Name), ".xml") {
+			continue
+		}
+		cdr, err := leerCDRDeZip(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
 		}
+		cdrs = append(cdrs, cdr)
 	}
+	if len(cdrs) == 0 {
+		return nil, fmt.Errorf("no se encontró ningún archivo XML dentro del ZIP del CDR")
+	}
+	return cdrs, nil
+}
 
-	return "", fmt.Errorf("no se encontró ningún archivo XML dentro del ZIP del CDR")
+func leerCDRDeZip(file *zip.File) (*CDR, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	cdrContent, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	cdr, err := parsearCDR(cdrContent)
+	if err != nil {
+		return nil, err
+	}
+	cdr.Archivo = path.Base(file.Name)
+	return cdr, nil
 }
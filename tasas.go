@@ -0,0 +1,85 @@
+package main
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Regímenes del emisor que determinan la tasa de IGV aplicable.
+const (
+	regimenGeneral = "GENERAL"
+	// MYPE cuya actividad principal es restaurante, hotel o alojamiento turístico (Ley 31556).
+	regimenMypeRestauranteHotel = "MYPE_RESTAURANTE_HOTEL"
+)
+
+// tramoTasa es un periodo de vigencia de la tasa combinada de IGV + IPM.
+type tramoTasa struct {
+	desde, hasta time.Time
+	tasa         decimal.Decimal
+	norma        string
+}
+
+func fechaTabla(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", s, zonaLima)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+var (
+	// tasaIGVGeneral es la tasa combinada IGV (16%) + IPM (2%).
+	tasaIGVGeneral = decimal.RequireFromString("0.18")
+
+	// tablaTasasIGV define las tasas reducidas por régimen y fecha de emisión. Fuera de
+	// estos tramos se aplica la tasa general.
+	tablaTasasIGV = map[string][]tramoTasa{
+		regimenMypeRestauranteHotel: {
+			{desde: fechaTabla("2022-09-01"), hasta: fechaTabla("2024-12-31"), tasa: decimal.RequireFromString("0.10"), norma: "Ley N° 31556"},
+			{desde: fechaTabla("2025-01-01"), hasta: fechaTabla("2025-12-31"), tasa: decimal.RequireFromString("0.10"), norma: "Ley N° 31556, prorrogada por Ley N° 32219"},
+			{desde: fechaTabla("2026-01-01"), hasta: fechaTabla("2026-12-31"), tasa: decimal.RequireFromString("0.105"), norma: "Ley N° 31556, prorrogada por Ley N° 32219"},
+		},
+	}
+)
+
+// regimenValido indica si el régimen informado para el emisor es conocido.
+func regimenValido(regimen string) bool {
+	if regimen == "" || regimen == regimenGeneral {
+		return true
+	}
+	_, ok := tablaTasasIGV[regimen]
+	return ok
+}
+
+// tramoVigente devuelve el tramo de tasa reducida que aplica al documento, si lo hay.
+func tramoVigente(d *DocumentoElectronico) (tramoTasa, bool) {
+	emision, err := time.ParseInLocation("2006-01-02", d.FechaEmision, zonaLima)
+	if err != nil {
+		return tramoTasa{}, false
+	}
+	for _, t := range tablaTasasIGV[d.Emisor.Regimen] {
+		if !emision.Before(t.desde) && !emision.After(t.hasta) {
+			return t, true
+		}
+	}
+	return tramoTasa{}, false
+}
+
+// tasaIGVDocumento devuelve la tasa combinada de IGV + IPM según el régimen del emisor
+// y la fecha de emisión. Se usa tanto en el XML como en los cálculos del validador.
+func tasaIGVDocumento(d *DocumentoElectronico) decimal.Decimal {
+	if t, ok := tramoVigente(d); ok {
+		return t.tasa
+	}
+	return tasaIGVGeneral
+}
+
+// tasaIGVLinea devuelve la tasa que se informa en cbc:Percent de la línea: la reducida solo
+// alcanza a las operaciones gravadas (afectación 10 y 17); las demás conservan la general.
+func tasaIGVLinea(d *DocumentoElectronico, item Detalle) decimal.Decimal {
+	if item.AfectacionIGV == afectacionGravadaOnerosa || item.AfectacionIGV == afectacionGravadaIVAP {
+		return tasaIGVDocumento(d)
+	}
+	return tasaIGVGeneral
+}
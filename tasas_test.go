@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestTasaIGVDocumento(t *testing.T) {
+	casos := []struct {
+		regimen, fecha string
+		tasa           string
+	}{
+		{regimenGeneral, "2025-06-15", "0.18"},
+		{"", "2026-03-01", "0.18"},
+		{regimenMypeRestauranteHotel, "2022-08-31", "0.18"},
+		{regimenMypeRestauranteHotel, "2022-09-01", "0.1"},
+		{regimenMypeRestauranteHotel, "2024-12-31", "0.1"},
+		{regimenMypeRestauranteHotel, "2025-01-01", "0.1"},
+		{regimenMypeRestauranteHotel, "2025-12-31", "0.1"},
+		{regimenMypeRestauranteHotel, "2026-01-01", "0.105"},
+		{regimenMypeRestauranteHotel, "2026-12-31", "0.105"},
+		{regimenMypeRestauranteHotel, "2027-01-01", "0.18"},
+		{regimenMypeRestauranteHotel, "31/12/2026", "0.18"},
+	}
+	for _, c := range casos {
+		d := &DocumentoElectronico{FechaEmision: c.fecha, Emisor: Empresa{Regimen: c.regimen}}
+		if tasa := tasaIGVDocumento(d); tasa.String() != c.tasa {
+			t.Errorf("tasa de %q el %s = %s, se esperaba %s", c.regimen, c.fecha, tasa, c.tasa)
+		}
+	}
+}
+
+func TestTasaIGVLinea(t *testing.T) {
+	d := &DocumentoElectronico{FechaEmision: "2026-03-01", Emisor: Empresa{Regimen: regimenMypeRestauranteHotel}}
+	casos := []struct {
+		afectacion string
+		tasa       string
+	}{
+		{afectacionGravadaOnerosa, "0.105"},
+		{afectacionGravadaIVAP, "0.105"},
+		{"20", "0.18"},
+		{"30", "0.18"},
+		{"40", "0.18"},
+	}
+	for _, c := range casos {
+		if tasa := tasaIGVLinea(d, Detalle{AfectacionIGV: c.afectacion}); tasa.String() != c.tasa {
+			t.Errorf("tasa de la línea con afectación %s = %s, se esperaba %s", c.afectacion, tasa, c.tasa)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ConfigTransporte ajusta las conexiones salientes hacia SUNAT y el OSE: proxy corporativo,
+// CA adicionales (por ejemplo la del proxy que inspecciona TLS), versión mínima de TLS y el
+// pool de conexiones. Todos los emisores comparten el mismo transporte.
+type ConfigTransporte struct {
+	// Proxy es la URL del proxy de salida ("http://proxy.interno:3128"). Si se omite se
+	// usan HTTPS_PROXY, HTTP_PROXY y NO_PROXY del entorno.
+	Proxy        string `json:"proxy,omitempty"`
+	ProxyUsuario string `json:"proxyUsuario,omitempty"`
+	// La clave del proxy también puede venir de SUNAT_PROXY_CLAVE o de un archivo de secreto.
+	ProxyClave        secreto `json:"proxyClave,omitempty"`
+	ProxyClaveArchivo string  `json:"proxyClaveArchivo,omitempty"`
+	// CAsAdicionales son archivos PEM que se suman a las CA del sistema.
+	CAsAdicionales []string `json:"casAdicionales,omitempty"`
+	// TLSMinimo es "1.2" (por defecto) o "1.3".
+	TLSMinimo string `json:"tlsMinimo,omitempty"`
+	// MaxConexionesPorHost limita las conexiones simultáneas a un mismo servicio (0 = sin límite).
+	MaxConexionesPorHost int `json:"maxConexionesPorHost,omitempty"`
+	// MaxConexionesInactivas es cuántas conexiones ociosas por servicio se conservan.
+	MaxConexionesInactivas int `json:"maxConexionesInactivas,omitempty"`
+	// InactividadMs es cuánto se conserva una conexión ociosa antes de cerrarla.
+	InactividadMs int `json:"inactividadMs,omitempty"`
+	// KeepAliveMs es el intervalo de los keep-alive TCP.
+	KeepAliveMs int `json:"keepAliveMs,omitempty"`
+}
+
+var versionesTLS = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// crearTransporte arma el http.Transport con que todos los clientes llaman a SUNAT. Parte
+// del transporte por defecto de Go y solo cambia lo configurado.
+func crearTransporte(cfg ConfigTransporte) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("la URL del proxy %q no es válida", cfg.Proxy)
+		}
+		clave, err := leerSecreto("SUNAT_PROXY_CLAVE", "SUNAT_PROXY_CLAVE_ARCHIVO", cfg.ProxyClaveArchivo, cfg.ProxyClave)
+		if err != nil {
+			return nil, fmt.Errorf("no se pudo leer el secreto de la clave del proxy: %w", err)
+		}
+		if usuario := primeroNoVacio(os.Getenv("SUNAT_PROXY_USUARIO"), cfg.ProxyUsuario); usuario != "" {
+			registrarSecreto(clave)
+			proxy.User = url.UserPassword(usuario, clave)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	version, ok := versionesTLS[cfg.TLSMinimo]
+	if !ok {
+		return nil, fmt.Errorf("versión mínima de TLS desconocida %q: se espera 1.2 o 1.3", cfg.TLSMinimo)
+	}
+	t.TLSClientConfig = &tls.Config{MinVersion: version}
+	if len(cfg.CAsAdicionales) > 0 {
+		raices, err := x509.SystemCertPool()
+		if err != nil {
+			raices = x509.NewCertPool()
+		}
+		certs, err := cargarCertificados(cfg.CAsAdicionales)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			raices.AddCert(cert)
+		}
+		t.TLSClientConfig.RootCAs = raices
+	}
+
+	if cfg.MaxConexionesPorHost > 0 {
+		t.MaxConnsPerHost = cfg.MaxConexionesPorHost
+	}
+	if cfg.MaxConexionesInactivas > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxConexionesInactivas
+	}
+	if cfg.InactividadMs > 0 {
+		t.IdleConnTimeout = time.Duration(cfg.InactividadMs) * time.Millisecond
+	}
+	if cfg.KeepAliveMs > 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: time.Duration(cfg.KeepAliveMs) * time.Millisecond}
+		t.DialContext = dialer.DialContext
+	}
+	return t, nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"mi-conversor-ubl/catalogos"
+)
+
+// ErrorValidacion describe una regla de negocio de SUNAT que el documento no cumple.
+// Los códigos 4000 en adelante son observaciones: SUNAT acepta el comprobante igual.
+type ErrorValidacion struct {
+	Codigo  string `json:"codigo"`
+	Mensaje string `json:"mensaje"`
+	Ruta    string `json:"ruta"`
+}
+
+// EsObservacion indica si SUNAT aceptaría el comprobante pese a esta regla.
+func (e ErrorValidacion) EsObservacion() bool {
+	n, err := strconv.Atoi(e.Codigo)
+	return err == nil && n >= 4000
+}
+
+// ResultadoValidacion agrupa todas las reglas incumplidas por un documento.
+type ResultadoValidacion []ErrorValidacion
+
+// Errores devuelve solo las reglas que provocarían el rechazo del comprobante.
+func (r ResultadoValidacion) Errores() ResultadoValidacion {
+	var errs ResultadoValidacion
+	for _, e := range r {
+		if !e.EsObservacion() {
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// Observaciones devuelve las reglas que SUNAT solo registraría como observación.
+func (r ResultadoValidacion) Observaciones() ResultadoValidacion {
+	var obs ResultadoValidacion
+	for _, e := range r {
+		if e.EsObservacion() {
+			obs = append(obs, e)
+		}
+	}
+	return obs
+}
+
+// Mensajes oficiales de las reglas de validación de SUNAT que se replican localmente.
+var mensajesValidacion = map[string]string{
+	"1001": "El dato SERIE-CORRELATIVO no cumple con el formato de acuerdo al tipo de comprobante",
+	"1003": "El tipo de comprobante no es válido o no está soportado",
+	"2014": "El número de RUC del emisor no es válido",
+	"2015": "Las boletas por importes mayores a S/ 700.00 deben identificar al adquiriente",
+	"2017": "El número de RUC del receptor no es válido",
+	"2023": "El comprobante debe contener al menos una línea de detalle",
+	"2040": "El tipo de afectación del IGV no existe en el catálogo 07",
+	"2108": "Presentación fuera de fecha",
+	"2116": "El tipo de documento del comprobante que modifica no corresponde a la serie de la nota",
+	"2172": "El motivo de la nota no existe en el catálogo de tipos de nota (09 o 10)",
+	"2329": "La fecha de emisión se encuentra fuera del límite permitido",
+	"2524": "Debe consignar la serie y el número del comprobante que modifica la nota",
+	"2775": "El ubigeo no existe en el catálogo de ubigeos del INEI",
+	"2776": "El departamento, provincia o distrito no corresponde al ubigeo",
+	"2800": "El tipo de documento de identidad del receptor no está permitido para el tipo de comprobante",
+	"2801": "El número de DNI del receptor no cumple con el formato establecido",
+	"2802": "El número de documento de identidad del receptor no cumple con el formato establecido",
+	"2883": "La unidad de medida no existe en el catálogo 03",
+	"2920": "El tipo de comprobante que modifica la nota debe ser factura o boleta",
+	"3002": "El código de producto SUNAT debe ser un código UNSPSC de 8 dígitos (catálogo 25)",
+	"3003": "El código GTIN no tiene una longitud válida o su dígito de control es incorrecto",
+	"3007": "El código de leyenda no existe en el catálogo 52",
+	"3027": "Debe consignar la leyenda 1000 con el monto en letras",
+	"3071": "El código de la propiedad adicional del ítem no existe en el catálogo 55",
+	"3072": "La propiedad adicional del ítem debe tener un valor o un periodo",
+	"3073": "El periodo de la propiedad adicional del ítem no es válido (formato AAAA-MM-DD)",
+	"3088": "La moneda del comprobante no existe en el catálogo 02",
+	"3105": "El IGV de la línea no coincide con la base imponible por la tasa del tributo",
+	"3110": "El régimen tributario del emisor no es válido",
+	"3203": "Debe consignar el motivo o sustento de la nota",
+	"4269": "El código de producto no debe exceder los 30 caracteres",
+	"4288": "El valor de venta de la línea no coincide con la cantidad por el valor unitario",
+	"4290": "El total gravado no coincide con la suma de las bases imponibles gravadas",
+	"4301": "El total de IGV no coincide con la suma del IGV de las líneas",
+	"4312": "El importe total no coincide con la suma de valores de venta más tributos",
+}
+
+const (
+	tipoFactura     = "01"
+	tipoBoleta      = "03"
+	tipoNotaCredito = "07"
+	tipoNotaDebito  = "08"
+
+	afectacionGravadaOnerosa = "10"
+	afectacionGravadaIVAP    = "17"
+	tipoDocRUC               = "6"
+	leyendaMontoEnLetras     = "1000"
+)
+
+var (
+	// SUNAT admite una diferencia de más/menos un sol en los cálculos.
+	toleranciaCalculo = decimal.NewFromInt(1)
+	// Perú no tiene horario de verano; evitamos depender de tzdata.
+	zonaLima = time.FixedZone("PET", -5*60*60)
+
+	regexCorrelativo = regexp.MustCompile(`^[0-9]{1,8}$`)
+	regexSerie       = map[string]*regexp.Regexp{
+		tipoFactura:     regexp.MustCompile(`^(F[A-Z0-9]{3}|[0-9]{4})$`),
+		tipoBoleta:      regexp.MustCompile(`^(B[A-Z0-9]{3}|[0-9]{4})$`),
+		tipoNotaCredito: regexp.MustCompile(`^([FB][A-Z0-9]{3}|[0-9]{4})$`),
+		tipoNotaDebito:  regexp.MustCompile(`^([FB][A-Z0-9]{3}|[0-9]{4})$`),
+	}
+	// Días calendario que SUNAT admite entre la emisión y el envío.
+	plazoEnvioDias = map[string]int{
+		tipoFactura:     3,
+		tipoBoleta:      7,
+		tipoNotaCredito: 3,
+		tipoNotaDebito:  3,
+	}
+)
+
+// validacion acumula las reglas incumplidas mientras se recorre el documento.
+type validacion struct {
+	// entorno es el del emisor ("beta", "produccion", ...); algunas reglas son más laxas en beta.
+	entorno   string
+	resultado ResultadoValidacion
+}
+
+func (v *validacion) agregar(codigo, ruta string) {
+	v.agregarDetalle(codigo, ruta, "")
+}
+
+func (v *validacion) agregarDetalle(codigo, ruta, detalle string) {
+	mensaje := mensajesValidacion[codigo]
+	if detalle != "" {
+		mensaje = fmt.Sprintf("%s: %s", mensaje, detalle)
+	}
+	v.resultado = append(v.resultado, ErrorValidacion{Codigo: codigo, Mensaje: mensaje, Ruta: ruta})
+}
+
+// validarCodigo reporta la regla si el código no está en el catálogo. Un catálogo parcial
+// también rechaza el código: que sea oficial no puede comprobarse localmente, y se pide
+// agregarlo al archivo del catálogo en lugar de enviarlo a ciegas.
+func (v *validacion) validarCodigo(catalogo, codigo, regla, ruta string) {
+	if catalogos.Valido(catalogo, codigo) {
+		return
+	}
+	if catalogos.Completo(catalogo) {
+		v.agregarDetalle(regla, ruta, codigo)
+		return
+	}
+	v.agregarDetalle(regla, ruta, fmt.Sprintf("%s no figura en la copia parcial del catálogo %s; si es un código oficial, agréguelo a catalogos/datos/catalogo%s.tsv", codigo, catalogo, catalogo))
+}
+
+// reglasValidacion se ejecutan en orden y cada una reporta todas sus fallas.
+var reglasValidacion = []func(d *DocumentoElectronico, ahora time.Time, v *validacion){
+	validarSerieCorrelativo,
+	validarCodigosCatalogo,
+	validarRegimenEmisor,
+	validarTipoDocReceptor,
+	validarDocumentosIdentidad,
+	validarBoletaIdentificada,
+	validarUbigeos,
+	validarCodigosProducto,
+	validarPropiedadesAdicionales,
+	validarFechaEmision,
+	validarNota,
+	validarLeyendas,
+	validarLineas,
+	validarTotales,
+}
+
+// ValidarDocumento replica las validaciones de SUNAT antes de enviar el comprobante,
+// para no gastar un envío (ni un correlativo) en un documento que será rechazado.
+func ValidarDocumento(d *DocumentoElectronico, ahora time.Time, entorno string) ResultadoValidacion {
+	v := &validacion{entorno: entorno}
+	if _, ok := regexSerie[d.TipoDocumento]; !ok {
+		v.agregarDetalle("1003", "$.tipoDocumento", d.TipoDocumento)
+		return v.resultado
+	}
+	for _, regla := range reglasValidacion {
+		regla(d, ahora, v)
+	}
+	return v.resultado
+}
+
+func validarSerieCorrelativo(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	if !regexSerie[d.TipoDocumento].MatchString(d.Serie) {
+		v.agregarDetalle("1001", "$.serie", d.Serie)
+	}
+	if !regexCorrelativo.MatchString(d.Correlativo) {
+		v.agregarDetalle("1001", "$.correlativo", d.Correlativo)
+	}
+}
+
+// validarCodigosCatalogo comprueba que los códigos libres del JSON existan en los catálogos de SUNAT.
+func validarCodigosCatalogo(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	v.validarCodigo(catalogos.Moneda, d.Moneda, "3088", "$.moneda")
+	v.validarCodigo(catalogos.DocumentoIdentidad, d.Receptor.TipoDocIdentidad, "2800", "$.receptor.tipoDocIdentidad")
+	for i, l := range d.Leyendas {
+		v.validarCodigo(catalogos.Leyenda, l.Codigo, "3007", fmt.Sprintf("$.leyendas[%d].codigo", i))
+	}
+	for i, item := range d.Detalles {
+		ruta := fmt.Sprintf("$.detalles[%d]", i)
+		v.validarCodigo(catalogos.UnidadMedida, item.UnidadMedida, "2883", ruta+".unidadMedida")
+		v.validarCodigo(catalogos.AfectacionIGV, item.AfectacionIGV, "2040", ruta+".afectacionIGV")
+	}
+	motivos := map[string]string{tipoNotaCredito: catalogos.MotivoNotaCredito, tipoNotaDebito: catalogos.MotivoNotaDebito}
+	if catalogo, ok := motivos[d.TipoDocumento]; ok && d.MotivoNotaCredito != "" {
+		v.validarCodigo(catalogo, d.MotivoNotaCredito, "2172", "$.motivoNotaCredito")
+	}
+}
+
+func validarRegimenEmisor(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	if !regimenValido(d.Emisor.Regimen) {
+		v.agregarDetalle("3110", "$.emisor.regimen", d.Emisor.Regimen)
+	}
+}
+
+func validarTipoDocReceptor(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	facturable := d.TipoDocumento == tipoFactura ||
+		(esNota(d.TipoDocumento) && d.DocAfectadoTipo == tipoFactura)
+	if facturable && d.Receptor.TipoDocIdentidad != tipoDocRUC && catalogos.Valido(catalogos.DocumentoIdentidad, d.Receptor.TipoDocIdentidad) {
+		v.agregarDetalle("2800", "$.receptor.tipoDocIdentidad", d.Receptor.TipoDocIdentidad)
+	}
+}
+
+func validarFechaEmision(d *DocumentoElectronico, ahora time.Time, v *validacion) {
+	fecha, err := time.ParseInLocation("2006-01-02", d.FechaEmision, zonaLima)
+	if err != nil {
+		v.agregarDetalle("2329", "$.fechaEmision", "se espera el formato AAAA-MM-DD")
+		return
+	}
+	hoy := ahora.In(zonaLima)
+	hoy = time.Date(hoy.Year(), hoy.Month(), hoy.Day(), 0, 0, 0, 0, zonaLima)
+	if fecha.After(hoy) {
+		v.agregarDetalle("2329", "$.fechaEmision", "la fecha es posterior a hoy")
+		return
+	}
+	if plazo := plazoEnvioDias[d.TipoDocumento]; fecha.Before(hoy.AddDate(0, 0, -plazo)) {
+		v.agregarDetalle("2108", "$.fechaEmision", fmt.Sprintf("el plazo de envío es de %d días", plazo))
+	}
+}
+
+func validarNota(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	if !esNota(d.TipoDocumento) {
+		return
+	}
+	if d.DocAfectadoSerie == "" {
+		v.agregar("2524", "$.docAfectadoSerie")
+	}
+	if d.DocAfectadoCorrelativo == "" {
+		v.agregar("2524", "$.docAfectadoCorrelativo")
+	}
+	switch d.DocAfectadoTipo {
+	case tipoFactura, tipoBoleta:
+		letra := map[string]string{tipoFactura: "F", tipoBoleta: "B"}[d.DocAfectadoTipo]
+		if strings.HasPrefix(d.Serie, "F") || strings.HasPrefix(d.Serie, "B") {
+			if !strings.HasPrefix(d.Serie, letra) {
+				v.agregarDetalle("2116", "$.serie", d.Serie)
+			}
+			if d.DocAfectadoSerie != "" && !strings.HasPrefix(d.DocAfectadoSerie, letra) {
+				v.agregarDetalle("2116", "$.docAfectadoSerie", d.DocAfectadoSerie)
+			}
+		}
+	default:
+		v.agregarDetalle("2920", "$.docAfectadoTipo", d.DocAfectadoTipo)
+	}
+	if strings.TrimSpace(d.MotivoNotaCredito) == "" {
+		v.agregar("3203", "$.motivoNotaCredito")
+	}
+}
+
+func validarLeyendas(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	for _, l := range d.Leyendas {
+		if l.Codigo == leyendaMontoEnLetras && strings.TrimSpace(l.Valor) != "" {
+			return
+		}
+	}
+	v.agregar("3027", "$.leyendas")
+}
+
+func validarLineas(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	if len(d.Detalles) == 0 {
+		v.agregar("2023", "$.detalles")
+		return
+	}
+	tasa := tasaIGVDocumento(d)
+	for i, item := range d.Detalles {
+		ruta := fmt.Sprintf("$.detalles[%d]", i)
+		if !dentroDeTolerancia(item.Cantidad.Mul(item.ValorUnitario), item.ValorTotal) {
+			v.agregarDetalle("4288", ruta+".valorTotal", item.ValorTotal.StringFixed(2))
+		}
+		igvEsperado := decimal.Zero
+		if item.AfectacionIGV == afectacionGravadaOnerosa {
+			igvEsperado = item.ValorTotal.Mul(tasa)
+		}
+		if !dentroDeTolerancia(igvEsperado, item.IGV) {
+			v.agregarDetalle("3105", ruta+".igv", fmt.Sprintf("se esperaba %s", igvEsperado.StringFixed(2)))
+		}
+	}
+}
+
+func validarTotales(d *DocumentoElectronico, _ time.Time, v *validacion) {
+	gravado, valorVenta, igv := decimal.Zero, decimal.Zero, decimal.Zero
+	for _, item := range d.Detalles {
+		if item.AfectacionIGV == afectacionGravadaOnerosa {
+			gravado = gravado.Add(item.ValorTotal)
+		}
+		valorVenta = valorVenta.Add(item.ValorTotal)
+		igv = igv.Add(item.IGV)
+	}
+	if !dentroDeTolerancia(gravado, d.TotalGravado) {
+		v.agregarDetalle("4290", "$.totalGravado", fmt.Sprintf("se esperaba %s", gravado.StringFixed(2)))
+	}
+	if !dentroDeTolerancia(igv, d.TotalIGV) {
+		v.agregarDetalle("4301", "$.totalIGV", fmt.Sprintf("se esperaba %s", igv.StringFixed(2)))
+	}
+	if total := valorVenta.Add(d.TotalIGV); !dentroDeTolerancia(total, d.TotalGeneral) {
+		v.agregarDetalle("4312", "$.totalGeneral", fmt.Sprintf("se esperaba %s", total.StringFixed(2)))
+	}
+}
+
+// --- Funciones de ayuda ---
+
+func esNota(tipoDocumento string) bool {
+	return tipoDocumento == tipoNotaCredito || tipoDocumento == tipoNotaDebito
+}
+
+func dentroDeTolerancia(esperado, obtenido decimal.Decimal) bool {
+	return esperado.Sub(obtenido).Abs().LessThanOrEqual(toleranciaCalculo)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// facturaPrueba lee factura_prueba.json, una factura del 2025-01-07 que cumple todas las reglas.
+func facturaPrueba(t *testing.T) *DocumentoElectronico {
+	t.Helper()
+	data, err := os.ReadFile("factura_prueba.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d DocumentoElectronico
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	return &d
+}
+
+func TestValidarDocumento(t *testing.T) {
+	ahora := time.Date(2025, 1, 7, 12, 0, 0, 0, zonaLima)
+	casos := []struct {
+		nombre      string
+		entorno     string
+		modificar   func(d *DocumentoElectronico)
+		codigo      string // "" si el documento debe pasar sin errores
+		ruta        string
+		observacion bool
+	}{
+		{nombre: "factura válida", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) {}},
+		{nombre: "RUC válido en producción", entorno: entornoProduccion, modificar: func(d *DocumentoElectronico) { d.Emisor.RUC = "20100066603" }},
+		{nombre: "RUC de prueba en producción", entorno: entornoProduccion, modificar: func(d *DocumentoElectronico) { d.Emisor.RUC = "20601546913" }, codigo: "2014", ruta: "$.emisor.ruc"},
+		{nombre: "RUC mal formado en beta", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Emisor.RUC = "30601546913" }, codigo: "2014", ruta: "$.emisor.ruc"},
+		{nombre: "serie de boleta en factura", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Serie = "B001" }, codigo: "1001", ruta: "$.serie"},
+		{nombre: "moneda inexistente", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Moneda = "ZZZ" }, codigo: "3088", ruta: "$.moneda"},
+		{nombre: "unidad fuera de la copia parcial", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Detalles[0].UnidadMedida = "XZZ" }, codigo: "2883", ruta: "$.detalles[0].unidadMedida"},
+		{nombre: "código de producto SUNAT válido", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Detalles[0].CodigoProductoSUNAT = "43211503" }},
+		{nombre: "segmento UNSPSC inexistente", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Detalles[0].CodigoProductoSUNAT = "99000000" }, codigo: "3002", ruta: "$.detalles[0].codigoProductoSunat"},
+		{nombre: "departamento inexistente", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Receptor.Direccion.Ubigeo = "260101" }, codigo: "2775", ruta: "$.receptor.direccion.ubigeo"},
+		{nombre: "distrito fuera de la copia parcial", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Receptor.Direccion.Ubigeo = "150199" }, codigo: "2775", ruta: "$.receptor.direccion.ubigeo"},
+		{nombre: "fecha futura", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.FechaEmision = "2025-01-08" }, codigo: "2329", ruta: "$.fechaEmision"},
+		{nombre: "régimen desconocido", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Emisor.Regimen = "RUS" }, codigo: "3110", ruta: "$.emisor.regimen"},
+		{nombre: "sin monto en letras", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) { d.Leyendas = nil }, codigo: "3027", ruta: "$.leyendas"},
+		{nombre: "IGV total dentro de la tolerancia", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) {
+			d.TotalIGV = d.TotalIGV.Add(decimal.NewFromInt(1))
+			d.TotalGeneral = d.TotalGeneral.Add(decimal.NewFromInt(1))
+		}},
+		{nombre: "IGV total descuadrado", entorno: entornoBeta, modificar: func(d *DocumentoElectronico) {
+			d.TotalIGV = d.TotalIGV.Add(decimal.NewFromInt(2))
+			d.TotalGeneral = d.TotalGeneral.Add(decimal.NewFromInt(2))
+		}, codigo: "4301", ruta: "$.totalIGV", observacion: true},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			d := facturaPrueba(t)
+			c.modificar(d)
+			res := ValidarDocumento(d, ahora, c.entorno)
+			if c.codigo == "" {
+				if len(res) > 0 {
+					t.Fatalf("se esperaba un documento válido y se obtuvo %+v", res)
+				}
+				return
+			}
+			if len(res) != 1 {
+				t.Fatalf("se esperaba solo la regla %s y se obtuvo %+v", c.codigo, res)
+			}
+			e := res[0]
+			if e.Codigo != c.codigo || e.Ruta != c.ruta || e.EsObservacion() != c.observacion {
+				t.Errorf("se obtuvo %s en %s (observación %t), se esperaba %s en %s (observación %t)", e.Codigo, e.Ruta, e.EsObservacion(), c.codigo, c.ruta, c.observacion)
+			}
+		})
+	}
+}
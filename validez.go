@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ConsultaValidez identifica el comprobante (normalmente de un proveedor) cuya validez se
+// consulta con la API REST "consulta de validez de CPE" de SUNAT.
+type ConsultaValidez struct {
+	RUCEmisor       string          `json:"rucEmisor"`
+	TipoComprobante string          `json:"tipoComprobante"`
+	Serie           string          `json:"serie"`
+	Numero          string          `json:"numero"`
+	FechaEmision    string          `json:"fechaEmision"` // YYYY-MM-DD
+	Monto           decimal.Decimal `json:"monto"`
+}
+
+// CodigoDescripcion es un código de estado de SUNAT con su texto.
+type CodigoDescripcion struct {
+	Codigo      string `json:"codigo"`
+	Descripcion string `json:"descripcion"`
+}
+
+// ResultadoValidez es lo que SUNAT informa del comprobante y de su emisor.
+type ResultadoValidez struct {
+	EstadoComprobante  CodigoDescripcion `json:"estadoComprobante"`
+	EstadoRUC          CodigoDescripcion `json:"estadoRuc"`
+	CondicionDomicilio CodigoDescripcion `json:"condicionDomicilio"`
+	Observaciones      []string          `json:"observaciones,omitempty"`
+}
+
+// Valido indica si el comprobante existe y está aceptado o autorizado.
+func (r *ResultadoValidez) Valido() bool {
+	return r.EstadoComprobante.Codigo == "1" || r.EstadoComprobante.Codigo == "3"
+}
+
+var (
+	estadosComprobanteValidez = map[string]string{
+		"0": "NO EXISTE",
+		"1": "ACEPTADO",
+		"2": "ANULADO",
+		"3": "AUTORIZADO",
+		"4": "NO AUTORIZADO",
+	}
+	estadosRUCValidez = map[string]string{
+		"00": "ACTIVO",
+		"01": "BAJA PROVISIONAL",
+		"02": "BAJA PROV. POR OFICIO",
+		"03": "SUSPENSION TEMPORAL",
+		"10": "BAJA DEFINITIVA",
+		"11": "BAJA DE OFICIO",
+		"22": "INHABILITADO-VENT.UNICA",
+	}
+	condicionesDomicilioValidez = map[string]string{
+		"00": "HABIDO",
+		"09": "PENDIENTE",
+		"11": "POR VERIFICAR",
+		"12": "NO HABIDO",
+		"20": "NO HALLADO",
+	}
+)
+
+const scopeAPIContribuyente = "https://api.sunat.gob.pe/v1/contribuyente/contribuyentes"
+
+// tokenOAuth cachea el access_token de client credentials hasta poco antes de que venza.
+type tokenOAuth struct {
+	mu    sync.Mutex
+	valor string
+	vence time.Time
+}
+
+// margenToken evita usar un token que vencería en pleno viaje de la petición.
+const margenToken = time.Minute
+
+// ValidarComprobante consulta en SUNAT el estado de un comprobante, el estado del RUC de su
+// emisor y su condición de domicilio. La consulta se hace con las credenciales de la API del
+// emisor configurado en c (el contribuyente que consulta), no con las del proveedor.
+func (c *Client) ValidarComprobante(ctx context.Context, consulta ConsultaValidez) (*ResultadoValidez, error) {
+	fecha, err := time.Parse("2006-01-02", consulta.FechaEmision)
+	if err != nil {
+		return nil, fmt.Errorf("fecha de emisión inválida %q: se espera YYYY-MM-DD", consulta.FechaEmision)
+	}
+	cuerpo := map[string]string{
+		"numRuc":       consulta.RUCEmisor,
+		"codComp":      consulta.TipoComprobante,
+		"numeroSerie":  consulta.Serie,
+		"numero":       consulta.Numero,
+		"fechaEmision": fecha.Format("02/01/2006"),
+	}
+	if !consulta.Monto.IsZero() {
+		cuerpo["monto"] = consulta.Monto.StringFixed(2)
+	}
+	data, err := json.Marshal(cuerpo)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, plantilla := rutaAPI(primeroNoVacio(c.Entorno.URLAPI, urlAPISUNAT), "/v1/contribuyente/contribuyentes/{ruc}/validarcomprobante", "{ruc}", c.RUC)
+	respBody, err := c.llamarAPI(ctx, endpoint, plantilla, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var respuesta struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		Data    struct {
+			EstadoCp      string   `json:"estadoCp"`
+			EstadoRuc     string   `json:"estadoRuc"`
+			CondDomiRuc   string   `json:"condDomiRuc"`
+			Observaciones []string `json:"observaciones"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &respuesta); err != nil {
+		return nil, fmt.Errorf("respuesta de la API de validez mal formada: %w", err)
+	}
+	if !respuesta.Success {
+		return nil, fmt.Errorf("la API de validez rechazó la consulta: %s", strings.TrimSpace(respuesta.Message))
+	}
+	return &ResultadoValidez{
+		EstadoComprobante:  CodigoDescripcion{respuesta.Data.EstadoCp, estadosComprobanteValidez[respuesta.Data.EstadoCp]},
+		EstadoRUC:          CodigoDescripcion{respuesta.Data.EstadoRuc, estadosRUCValidez[respuesta.Data.EstadoRuc]},
+		CondicionDomicilio: CodigoDescripcion{respuesta.Data.CondDomiRuc, condicionesDomicilioValidez[respuesta.Data.CondDomiRuc]},
+		Observaciones:      respuesta.Data.Observaciones,
+	}, nil
+}
+
+// llamarAPI hace un POST JSON con el token vigente. Si SUNAT responde 401 el token pudo
+// haberse revocado antes de vencer: se descarta y se reintenta una sola vez con uno nuevo.
+// Cada intento, incluido el pedido del token, tiene el plazo de una consulta.
+func (c *Client) llamarAPI(ctx context.Context, endpoint, plantilla string, cuerpo []byte) ([]byte, error) {
+	for intento := 1; ; intento++ {
+		token, err := c.tokenAPI(ctx)
+		if err != nil {
+			return nil, err
+		}
+		estado, respBody, err := c.postAPI(ctx, endpoint, plantilla, "application/json", "Bearer "+token, cuerpo)
+		if err != nil {
+			return nil, fmt.Errorf("error al llamar a la API de SUNAT: %w", err)
+		}
+
+		if estado == http.StatusUnauthorized && intento == 1 {
+			c.invalidarToken()
+			continue
+		}
+		if estado != http.StatusOK {
+			return nil, &errorHTTP{Estado: estado, Cuerpo: string(respBody)}
+		}
+		return respBody, nil
+	}
+}
+
+// rutaAPI arma la URL de una API REST reemplazando en la plantilla cada marcador por su valor
+// (pares marcador, valor). Devuelve además la plantilla con la base, que identifica al
+// endpoint en los limitadores: el límite es del servicio, no del RUC ni del client_id que
+// van en la ruta.
+func rutaAPI(base, plantilla string, pares ...string) (endpoint, clave string) {
+	for i := 1; i < len(pares); i += 2 {
+		pares[i] = url.PathEscape(pares[i])
+	}
+	return base + strings.NewReplacer(pares...).Replace(plantilla), base + plantilla
+}
+
+// postAPI hace un POST a las API REST de SUNAT con el plazo de una consulta y devuelve el
+// estado HTTP y el cuerpo de la respuesta. plantilla es la que devolvió rutaAPI.
+func (c *Client) postAPI(ctx context.Context, endpoint, plantilla, tipoContenido, autorizacion string, cuerpo []byte) (int, []byte, error) {
+	liberar, err := c.limites.adquirir(ctx, plantilla)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer liberar()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.Plazos.ConsultaMs)*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(cuerpo))
+	if err != nil {
+		return 0, nil, fmt.Errorf("error al crear la petición HTTP: %w", err)
+	}
+	req.Header.Set("Content-Type", tipoContenido)
+	if autorizacion != "" {
+		req.Header.Set("Authorization", autorizacion)
+	}
+	if id := correlacionDe(ctx); id != "" {
+		req.Header.Set(cabeceraCorrelacion, id)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// tokenAPI devuelve el access_token cacheado o pide uno nuevo con client credentials.
+func (c *Client) tokenAPI(ctx context.Context) (string, error) {
+	if c.API.ClientID == "" {
+		return "", errors.New("el emisor no tiene credenciales de la API de SUNAT (apiClientId y apiClientSecret)")
+	}
+
+	c.token.mu.Lock()
+	defer c.token.mu.Unlock()
+	if c.token.valor != "" && time.Now().Add(margenToken).Before(c.token.vence) {
+		return c.token.valor, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"scope":         {scopeAPIContribuyente},
+		"client_id":     {c.API.ClientID},
+		"client_secret": {string(c.API.ClientSecret)},
+	}
+	endpoint, plantilla := rutaAPI(primeroNoVacio(c.Entorno.URLAPISeguridad, urlAPISeguridadSUNAT), "/v1/clientesextranet/{clientId}/oauth2/token/", "{clientId}", c.API.ClientID)
+	estado, respBody, err := c.postAPI(ctx, endpoint, plantilla, "application/x-www-form-urlencoded", "", []byte(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("error al pedir el token de la API de SUNAT: %w", err)
+	}
+	if estado != http.StatusOK {
+		return "", fmt.Errorf("SUNAT no entregó el token de la API (HTTP %d): %s", estado, respBody)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(respBody, &token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("respuesta de token de la API de SUNAT mal formada")
+	}
+	c.token.valor = token.AccessToken
+	c.token.vence = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return c.token.valor, nil
+}
+
+func (c *Client) invalidarToken() {
+	c.token.mu.Lock()
+	defer c.token.mu.Unlock()
+	c.token.valor = ""
+}